@@ -1,5 +1,11 @@
 package limiter
 
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
 // AdmissionResult describes how a caller proceeded through the limiter.
 type AdmissionResult int
 
@@ -8,4 +14,78 @@ const (
 	AdmissionAcquired AdmissionResult = iota + 1
 	// AdmissionBypassed means the caller proceeded without consuming limiter capacity.
 	AdmissionBypassed
+	// AdmissionRejected means the caller was turned away because the waitlist was full.
+	AdmissionRejected
+	// AdmissionShed means the caller was removed from the waitlist to make room for more important work.
+	AdmissionShed
+	// AdmissionExpired means the caller's deadline was too close for the work to complete.
+	AdmissionExpired
+	// AdmissionPreempted means the caller's slot was reclaimed for a higher priority caller.
+	AdmissionPreempted
+	// AdmissionTimedOut means the configured timeout expired before capacity was acquired.
+	AdmissionTimedOut
+	// AdmissionCanceled means the context was done before capacity was acquired.
+	AdmissionCanceled
+	// AdmissionClosed means the limiter was closed before capacity was acquired.
+	AdmissionClosed
+)
+
+var admissionResultNames = map[AdmissionResult]string{
+	AdmissionAcquired:  "acquired",
+	AdmissionBypassed:  "bypassed",
+	AdmissionRejected:  "rejected",
+	AdmissionShed:      "shed",
+	AdmissionExpired:   "expired",
+	AdmissionPreempted: "preempted",
+	AdmissionTimedOut:  "timed out",
+	AdmissionCanceled:  "canceled",
+	AdmissionClosed:    "closed",
+}
+
+func (r AdmissionResult) String() string {
+	if name, ok := admissionResultNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("AdmissionResult(%d)", int(r))
+}
+
+var (
+	// ErrRejected is returned when the waitlist is full.
+	ErrRejected = errors.New("limiter: waitlist is full")
+	// ErrShed is returned when a waiter was removed from the waitlist to make room for more important work.
+	ErrShed = errors.New("limiter: shed from the waitlist")
+	// ErrPreempted is returned when a slot was reclaimed for a higher priority caller.
+	ErrPreempted = errors.New("limiter: slot preempted by a higher priority caller")
 )
+
+// AdmissionError is returned when a caller did not acquire capacity. It carries the outcome ,
+// how long the caller waited and its position in the waitlist. Use errors.Is with the
+// underlying error , e.g. errors.Is(err, limiter.ErrTimeout) or errors.Is(err, context.Canceled).
+type AdmissionError struct {
+	// Result is the outcome of the admission.
+	Result AdmissionResult
+	// Waited is the time spent in the limiter.
+	Waited time.Duration
+	// Position is the number of goroutines already waiting when the caller joined the waitlist.
+	Position int
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *AdmissionError) Error() string {
+	return fmt.Sprintf("%v (waited %v, position %d)", e.Err, e.Waited, e.Position)
+}
+
+// Unwrap returns the underlying error.
+func (e *AdmissionError) Unwrap() error {
+	return e.Err
+}
+
+// Outcome returns the AdmissionResult carried by err or 0 if err is not an AdmissionError.
+func Outcome(err error) AdmissionResult {
+	var ae *AdmissionError
+	if errors.As(err, &ae) {
+		return ae.Result
+	}
+	return 0
+}
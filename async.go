@@ -0,0 +1,145 @@
+package limiter
+
+import (
+	"context"
+	"time"
+)
+
+// asyncWait is the state of a caller waiting through AcquireAsync. It is guarded by l.mu.
+type asyncWait struct {
+	callback    func(*Permit, error)
+	executor    func(func())
+	start       time.Time
+	position    int
+	acquisition Acquisition
+	timer       Timer
+	stopCtx     func() bool
+}
+
+// stop releases the timer and the context registration of the waiter.
+func (a *asyncWait) stop() {
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	if a.stopCtx != nil {
+		a.stopCtx()
+	}
+}
+
+// WithExecutor configures how AcquireAsync invokes its callbacks , e.g. by posting them to an
+// event loop. The executor is never called while the limiter is locked. By default every callback
+// runs in its own goroutine.
+func WithExecutor(executor func(func())) func(*Limiter) {
+	return func(l *Limiter) {
+		l.executor = executor
+	}
+}
+
+func goExecutor(f func()) {
+	go f()
+}
+
+// AcquireAsync is like Acquire but it does not block the calling goroutine , and waiting callers
+// don't hold a goroutine. The callback is invoked once through the executor: with a permit when
+// capacity is granted , or with an *AdmissionError when the timeout elapses , the context is done ,
+// the waiting list is full or the limiter is closed.
+func (l *Limiter) AcquireAsync(ctx context.Context, callback func(*Permit, error)) {
+	l.acquireAsync(ctx, callback, l.executor)
+}
+
+// acquireAsync is AcquireAsync with the executor of the callback.
+func (l *Limiter) acquireAsync(ctx context.Context, callback func(*Permit, error), executor func(func())) {
+	a := &asyncWait{
+		callback: callback,
+		executor: executor,
+	}
+	a.acquisition = l.acquisition()
+	if l.tryAcquire() {
+		l.grant(a)
+		return
+	}
+	a.start = l.clock.Now()
+	ok, w, position, err := l.proceed(a)
+	if ok {
+		l.grant(a)
+		return
+	}
+	if err != nil {
+		admissionErr := l.enqueueError(err, a.start, position)
+		a.executor(func() {
+			callback(nil, admissionErr)
+		})
+		return
+	}
+
+	l.mu.Lock()
+	defer l.unlock()
+	if w.elem == nil {
+		// admitted or closed already , the waiter is notified when the lock is released.
+		return
+	}
+	if l.timeout != nil {
+		a.timer = l.clock.AfterFunc(*l.timeout, func() {
+			l.abandon(w, AdmissionTimedOut, ErrTimeout)
+		})
+	}
+	a.stopCtx = context.AfterFunc(ctx, func() {
+		l.abandon(w, AdmissionCanceled, ctx.Err())
+	})
+}
+
+// abandon removes an asynchronous waiter whose timeout elapsed or whose context is done.
+func (l *Limiter) abandon(w *waiter, outcome AdmissionResult, err error) {
+	if !l.removeWaiter(w) {
+		return
+	}
+	a := w.async
+	a.stop()
+	admissionErr := l.admissionError(outcome, err, a.start, a.position)
+	a.executor(func() {
+		a.callback(nil, admissionErr)
+	})
+}
+
+// grant hands acquired capacity to an asynchronous caller.
+func (l *Limiter) grant(a *asyncWait) {
+	permit := l.permit(a.acquisition)
+	a.executor(func() {
+		a.callback(permit, nil)
+	})
+}
+
+// signal wakes the waiter after it left the waiting list. Asynchronous waiters are notified once
+// l.mu is released. Callers must hold l.mu.
+func (l *Limiter) signal(w *waiter) {
+	close(w.done)
+	if w.async != nil {
+		l.pending = append(l.pending, func() {
+			l.notify(w)
+		})
+	}
+}
+
+// notify completes an asynchronous waiter which was admitted or closed by another goroutine.
+func (l *Limiter) notify(w *waiter) {
+	a := w.async
+	a.stop()
+	if w.err != nil {
+		admissionErr := l.admissionError(AdmissionClosed, w.err, a.start, a.position)
+		a.executor(func() {
+			a.callback(nil, admissionErr)
+		})
+		return
+	}
+	l.grant(a)
+}
+
+// unlock releases l.mu and notifies the asynchronous waiters which were signaled while it was held.
+func (l *Limiter) unlock() {
+	pending := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+	for _, f := range pending {
+		f()
+	}
+}
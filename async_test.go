@@ -0,0 +1,105 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireAsync_Granted(t *testing.T) {
+	l := New(1, WithExecutor(Inline))
+	var permit *Permit
+	l.AcquireAsync(context.Background(), func(p *Permit, err error) {
+		assert.NoError(t, err)
+		permit = p
+	})
+	assert.NotNil(t, permit)
+	assert.Equal(t, 1, l.Count())
+	assert.True(t, permit.Release())
+	assert.Equal(t, 0, l.Count())
+}
+
+func TestAcquireAsync_QueuedUntilFinish(t *testing.T) {
+	l := New(1, WithExecutor(Inline))
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+
+	var order []int
+	for i := 0; i < 2; i++ {
+		i := i
+		l.AcquireAsync(ctx, func(p *Permit, err error) {
+			assert.NoError(t, err)
+			order = append(order, i)
+			// the executor is not called while the limiter is locked , so the callback can release.
+			p.Release()
+		})
+	}
+	assert.Equal(t, 2, l.waitListSize())
+	assert.Empty(t, order)
+
+	l.Finish()
+	assert.Equal(t, []int{0, 1}, order)
+	assert.Equal(t, 0, l.Count())
+}
+
+func TestAcquireAsync_Canceled(t *testing.T) {
+	l := New(1)
+	assert.NoError(t, l.Wait(context.Background()))
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	l.AcquireAsync(ctx, func(p *Permit, err error) {
+		assert.Nil(t, p)
+		errs <- err
+	})
+	cancel()
+	err := <-errs
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, AdmissionCanceled, Outcome(err))
+	assert.Equal(t, 0, l.waitListSize())
+
+	// the slot is not given to the cancelled waiter.
+	l.Finish()
+	assert.Equal(t, 0, l.Count())
+}
+
+func TestAcquireAsync_Closed(t *testing.T) {
+	l := New(1, WithExecutor(Inline))
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+	var outcomes []AdmissionResult
+	l.AcquireAsync(ctx, func(p *Permit, err error) {
+		outcomes = append(outcomes, Outcome(err))
+	})
+	l.Close()
+	l.AcquireAsync(ctx, func(p *Permit, err error) {
+		outcomes = append(outcomes, Outcome(err))
+	})
+	assert.Equal(t, []AdmissionResult{AdmissionClosed, AdmissionClosed}, outcomes)
+}
+
+func TestAcquireAsync_WaitersDontHoldGoroutines(t *testing.T) {
+	l := New(1, WithExecutor(Inline), WithTimeoutDuration(time.Hour))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, l.Wait(ctx))
+
+	before := runtime.NumGoroutine()
+	granted := 0
+	for i := 0; i < 1000; i++ {
+		l.AcquireAsync(ctx, func(p *Permit, err error) {
+			if err == nil {
+				granted++
+				p.Release()
+			}
+		})
+	}
+	assert.Equal(t, 1000, l.waitListSize())
+	assert.Less(t, runtime.NumGoroutine()-before, 10)
+
+	l.Finish()
+	assert.Equal(t, 1000, granted)
+}
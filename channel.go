@@ -0,0 +1,83 @@
+package limiter
+
+import (
+	"context"
+	"sync"
+)
+
+// permitChan delivers the outcome of an asynchronous acquisition to a channel.
+type permitChan struct {
+	mu   sync.Mutex
+	ch   chan *Permit
+	done bool
+	err  error
+}
+
+// deliver sends the permit to the channel and closes it. The permit is released if the caller
+// cancelled the acquisition already.
+func (c *permitChan) deliver(permit *Permit, err error) {
+	c.mu.Lock()
+	if c.done {
+		c.mu.Unlock()
+		if permit != nil {
+			permit.Release()
+		}
+		return
+	}
+	c.done = true
+	c.err = err
+	if permit != nil {
+		c.ch <- permit
+	}
+	close(c.ch)
+	c.mu.Unlock()
+}
+
+// cancel abandons the acquisition and releases a permit which was delivered but not received.
+func (c *permitChan) cancel() error {
+	c.mu.Lock()
+	if !c.done {
+		c.done = true
+		close(c.ch)
+	}
+	err := c.err
+	c.mu.Unlock()
+	if permit, ok := <-c.ch; ok {
+		permit.Release()
+	}
+	return err
+}
+
+// Inline is an executor for WithExecutor which runs the callback in the goroutine completing the
+// acquisition. The callback must be short and must not block , it may release the permit.
+func Inline(f func()) {
+	f()
+}
+
+// PermitChan adapts an asynchronous acquisition to a channel , see AcquireChan. It is meant for
+// limiter implementations. acquire must start acquiring with the given context and call the
+// callback exactly once like AcquireAsync , the callback does not block so Inline can run it.
+func PermitChan(ctx context.Context, acquire func(ctx context.Context, callback func(*Permit, error))) (<-chan *Permit, func() error) {
+	ctx, stop := context.WithCancel(ctx)
+	c := &permitChan{ch: make(chan *Permit, 1)}
+	acquire(ctx, c.deliver)
+	return c.ch, func() error {
+		stop()
+		return c.cancel()
+	}
+}
+
+// AcquireChan starts acquiring capacity and returns a channel , so the caller can wait for it in a
+// select alongside other channels. The channel receives the permit once capacity is granted and
+// is closed without a permit when the caller is not admitted.
+//
+// cancel must be called once the caller stops waiting , it is safe to call it more than once. It
+// abandons the acquisition and releases a permit which was granted but not received , so no
+// capacity leaks when the permit is granted just as the caller gives up. A received permit must
+// still be released by the caller. cancel returns the *AdmissionError when the caller was not
+// admitted.
+func (l *Limiter) AcquireChan(ctx context.Context) (<-chan *Permit, func() error) {
+	return PermitChan(ctx, func(ctx context.Context, callback func(*Permit, error)) {
+		l.acquireAsync(ctx, callback, Inline)
+	})
+}
@@ -0,0 +1,118 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireChan_Granted(t *testing.T) {
+	l := New(1)
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+
+	permits, cancel := l.AcquireChan(ctx)
+	defer cancel()
+	select {
+	case <-permits:
+		t.Fatal("acquired while the limiter is full")
+	default:
+	}
+	l.Finish()
+	permit, ok := <-permits
+	assert.True(t, ok)
+	assert.Equal(t, 1, l.Count())
+	assert.True(t, permit.Release())
+	assert.NoError(t, cancel())
+	assert.Equal(t, 0, l.Count())
+}
+
+func TestAcquireChan_NotAdmitted(t *testing.T) {
+	l := New(1)
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+
+	permits, cancel := l.AcquireChan(ctx)
+	l.Close()
+	_, ok := <-permits
+	assert.False(t, ok)
+	err := cancel()
+	assert.Equal(t, AdmissionClosed, Outcome(err))
+	assert.Equal(t, err, cancel())
+}
+
+func TestAcquireChan_CancelWhileWaiting(t *testing.T) {
+	l := New(1)
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+
+	permits, cancel := l.AcquireChan(ctx)
+	assert.NoError(t, cancel())
+	_, ok := <-permits
+	assert.False(t, ok)
+	assert.Eventually(t, func() bool {
+		return l.waitListSize() == 0
+	}, time.Second, time.Millisecond)
+
+	l.Finish()
+	assert.Equal(t, 0, l.Count())
+}
+
+func TestAcquireChan_CancelAfterGrant(t *testing.T) {
+	l := New(1)
+	permits, cancel := l.AcquireChan(context.Background())
+	// the permit was granted but never received , cancel gives it back.
+	assert.Equal(t, 1, l.Count())
+	assert.NoError(t, cancel())
+	assert.Equal(t, 0, l.Count())
+	_, ok := <-permits
+	assert.False(t, ok)
+}
+
+func TestAcquireChan_AbandonRace(t *testing.T) {
+	l := New(2)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				permits, cancel := l.AcquireChan(ctx)
+				select {
+				case permit := <-permits:
+					permit.Release()
+				case <-time.After(time.Duration((i+j)%3) * time.Microsecond):
+				}
+				_ = cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Eventually(t, func() bool {
+		return l.Count() == 0 && l.waitListSize() == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestPermitChan_CustomAcquisition(t *testing.T) {
+	errRefused := errors.New("refused")
+	permits, cancel := PermitChan(context.Background(), func(ctx context.Context, callback func(*Permit, error)) {
+		callback(nil, errRefused)
+	})
+	_, ok := <-permits
+	assert.False(t, ok)
+	assert.Equal(t, errRefused, cancel())
+
+	released := 0
+	permits, cancel = PermitChan(context.Background(), func(ctx context.Context, callback func(*Permit, error)) {
+		callback(NewPermit(RealClock(), func() { released++ }, 0, nil, nil), nil)
+	})
+	assert.NoError(t, cancel())
+	assert.Equal(t, 1, released)
+	_, ok = <-permits
+	assert.False(t, ok)
+}
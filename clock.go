@@ -0,0 +1,74 @@
+package limiter
+
+import "time"
+
+// Clock tells the time and creates the timers used for timeouts , dynamic priority and leases.
+// Use WithClock to replace the real clock , e.g. with limitertest.FakeClock in tests.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+	// AfterFunc calls f after the duration. The real clock calls f in its own goroutine , a fake
+	// clock may call it on the goroutine which advances the clock , so f must not need locks that
+	// goroutine holds.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a single event created by a Clock.
+type Timer interface {
+	// C returns the channel on which the time is delivered , it is nil for timers created by AfterFunc.
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// Ticker delivers ticks at intervals , it is created by a Clock.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// RealClock returns the clock backed by the time package.
+func RealClock() Clock {
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// WithClock replaces the real clock used for timeouts and leases.
+func WithClock(clock Clock) func(*Limiter) {
+	return func(l *Limiter) {
+		l.clock = clock
+	}
+}
@@ -0,0 +1,112 @@
+package limiter_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/limitertest"
+)
+
+func TestLimiter_FakeClockTimeout(t *testing.T) {
+	clock := limitertest.NewFakeClock(time.Now())
+	l := limiter.New(1,
+		limiter.WithTimeoutDuration(10*time.Millisecond),
+		limiter.WithClock(clock),
+	)
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+
+	errs := make(chan error)
+	go func() {
+		errs <- l.Wait(ctx)
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(10 * time.Millisecond)
+
+	err := <-errs
+	var admissionErr *limiter.AdmissionError
+	if assert.True(t, errors.As(err, &admissionErr)) {
+		assert.Equal(t, limiter.AdmissionTimedOut, admissionErr.Result)
+		assert.Equal(t, 10*time.Millisecond, admissionErr.Waited)
+	}
+	assert.Equal(t, 1, l.Count())
+}
+
+func TestLimiter_FakeClockBypass(t *testing.T) {
+	clock := limitertest.NewFakeClock(time.Now())
+	l := limiter.New(1,
+		limiter.WithTimeoutDuration(10*time.Millisecond),
+		limiter.WithBypassBudget(1),
+		limiter.WithClock(clock),
+	)
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+
+	results := make(chan limiter.AdmissionResult, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			result, _ := l.WaitOrBypass(ctx)
+			results <- result
+		}()
+	}
+	clock.BlockUntil(2)
+	clock.Advance(10 * time.Millisecond)
+
+	outcomes := []limiter.AdmissionResult{<-results, <-results}
+	assert.ElementsMatch(t, []limiter.AdmissionResult{limiter.AdmissionBypassed, 0}, outcomes)
+	assert.Equal(t, 1, l.BypassCount())
+}
+
+func TestLimiter_FakeClockLease(t *testing.T) {
+	clock := limitertest.NewFakeClock(time.Now())
+	var expired []limiter.Lease
+	l := limiter.New(1,
+		limiter.WithLeaseDuration(time.Second),
+		limiter.WithLeaseExpiredHook(func(lease limiter.Lease) {
+			expired = append(expired, lease)
+		}),
+		limiter.WithClock(clock),
+	)
+	start := clock.Now()
+	permit, err := l.Acquire(context.Background())
+	assert.NoError(t, err)
+
+	clock.Advance(time.Second)
+	assert.Equal(t, 0, l.Count())
+	if assert.Len(t, expired, 1) {
+		assert.Equal(t, start, expired[0].Acquired)
+	}
+	assert.False(t, permit.Release())
+}
+
+func TestAcquireAsync_FakeClockTimeout(t *testing.T) {
+	clock := limitertest.NewFakeClock(time.Now())
+	l := limiter.New(1,
+		limiter.WithTimeoutDuration(10*time.Millisecond),
+		limiter.WithClock(clock),
+		limiter.WithExecutor(func(f func()) { f() }),
+	)
+	ctx := context.Background()
+	assert.NoError(t, l.Wait(ctx))
+
+	var err error
+	l.AcquireAsync(ctx, func(p *limiter.Permit, e error) {
+		assert.Nil(t, p)
+		err = e
+	})
+	clock.Advance(9 * time.Millisecond)
+	assert.NoError(t, err)
+	clock.Advance(time.Millisecond)
+
+	var admissionErr *limiter.AdmissionError
+	if assert.True(t, errors.As(err, &admissionErr)) {
+		assert.Equal(t, limiter.AdmissionTimedOut, admissionErr.Result)
+		assert.Equal(t, 10*time.Millisecond, admissionErr.Waited)
+	}
+	assert.Equal(t, 0, l.Waiting())
+	assert.Equal(t, 0, clock.Timers())
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"strings"
+	"time"
+)
+
+// buckets is the number of histogram buckets , bucket i counts latencies below 2^i microseconds
+// and the last bucket counts everything above.
+const buckets = 24
+
+// histogram is a log2 histogram of latencies. It is not safe for concurrent use , every worker
+// records into its own histogram and they are merged at the end.
+type histogram struct {
+	counts [buckets]int64
+	total  int64
+	sum    time.Duration
+	max    time.Duration
+}
+
+func (h *histogram) record(d time.Duration) {
+	i := bits.Len64(uint64(d / time.Microsecond))
+	if i >= buckets {
+		i = buckets - 1
+	}
+	h.counts[i]++
+	h.total++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+func (h *histogram) merge(o *histogram) {
+	for i, n := range o.counts {
+		h.counts[i] += n
+	}
+	h.total += o.total
+	h.sum += o.sum
+	if o.max > h.max {
+		h.max = o.max
+	}
+}
+
+// bound returns the upper bound of the bucket.
+func bound(i int) time.Duration {
+	return time.Duration(1<<uint(i)) * time.Microsecond
+}
+
+// quantile returns the upper bound of the bucket containing the quantile.
+func (h *histogram) quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	rank := int64(q * float64(h.total))
+	var seen int64
+	for i, n := range h.counts {
+		seen += n
+		if seen > rank {
+			if i == buckets-1 {
+				return h.max
+			}
+			return bound(i)
+		}
+	}
+	return h.max
+}
+
+func (h *histogram) mean() time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.total)
+}
+
+// write prints the non empty buckets with a bar proportional to their count.
+func (h *histogram) write(w io.Writer) {
+	fmt.Fprintf(w, "  mean %v  p50 <%v  p99 <%v  p99.9 <%v  max %v\n",
+		h.mean(), h.quantile(0.5), h.quantile(0.99), h.quantile(0.999), h.max)
+	if h.total == 0 {
+		return
+	}
+	first, last := -1, 0
+	for i, n := range h.counts {
+		if n > 0 {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	for i := first; i <= last; i++ {
+		label := fmt.Sprintf("<%v", bound(i))
+		if i == buckets-1 {
+			label = fmt.Sprintf(">=%v", bound(i-1))
+		}
+		pct := 100 * float64(h.counts[i]) / float64(h.total)
+		fmt.Fprintf(w, "  %10s %10d %6.2f%% %s\n", label, h.counts[i], pct, strings.Repeat("#", int(pct/2)))
+	}
+}
@@ -0,0 +1,305 @@
+// Command limiterbench hammers a real limiter from many goroutines and reports the throughput ,
+// the time goroutines spent blocked on mutexes and wait latency histograms.
+//
+//	limiterbench -mode wait -limit 8 -goroutines 256 -duration 5s
+//	limiterbench -mode priority -mix low=3,high=1 -hold 100us
+//
+// The modes are wait (Wait and Finish) , bypass (WaitOrBypass) , priority (priority Wait and
+// FinishPriority) and priority-bypass (priority WaitOrBypass).
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+)
+
+// mutexWait is the runtime metric of the total time goroutines spent blocked on sync.Mutex.
+const mutexWait = "/sync/mutex/wait/total:seconds"
+
+type config struct {
+	mode       string
+	limit      int
+	goroutines int
+	duration   time.Duration
+	hold       time.Duration
+	timeout    time.Duration
+	mix        map[priority.PriorityValue]int
+}
+
+// target is the limiter under test.
+type target interface {
+	acquire(ctx context.Context, pr priority.PriorityValue) (limiter.AdmissionResult, error)
+	release(pr priority.PriorityValue, result limiter.AdmissionResult)
+}
+
+type plainTarget struct {
+	l      *limiter.Limiter
+	bypass bool
+}
+
+func (t plainTarget) acquire(ctx context.Context, _ priority.PriorityValue) (limiter.AdmissionResult, error) {
+	if t.bypass {
+		return t.l.WaitOrBypass(ctx)
+	}
+	return limiter.AdmissionAcquired, t.l.Wait(ctx)
+}
+
+func (t plainTarget) release(_ priority.PriorityValue, result limiter.AdmissionResult) {
+	if result == limiter.AdmissionBypassed {
+		t.l.FinishBypass()
+		return
+	}
+	t.l.Finish()
+}
+
+type priorityTarget struct {
+	p      *priority.PriorityLimiter
+	bypass bool
+}
+
+func (t priorityTarget) acquire(ctx context.Context, pr priority.PriorityValue) (limiter.AdmissionResult, error) {
+	if t.bypass {
+		return t.p.WaitOrBypass(ctx, pr)
+	}
+	return limiter.AdmissionAcquired, t.p.Wait(ctx, pr)
+}
+
+func (t priorityTarget) release(pr priority.PriorityValue, result limiter.AdmissionResult) {
+	if result == limiter.AdmissionBypassed {
+		t.p.FinishBypass()
+		return
+	}
+	t.p.FinishPriority(pr)
+}
+
+func newTarget(cfg config) (target, error) {
+	switch cfg.mode {
+	case "wait", "bypass":
+		var options []limiter.Option
+		if cfg.timeout > 0 {
+			options = append(options, limiter.WithTimeoutDuration(cfg.timeout))
+		}
+		return plainTarget{l: limiter.New(cfg.limit, options...), bypass: cfg.mode == "bypass"}, nil
+	case "priority", "priority-bypass":
+		var options []priority.Option
+		if cfg.timeout > 0 {
+			options = append(options, priority.WithTimeoutDuration(cfg.timeout))
+		}
+		return priorityTarget{p: priority.NewLimiter(cfg.limit, options...), bypass: cfg.mode == "priority-bypass"}, nil
+	}
+	return nil, fmt.Errorf("unknown mode %q", cfg.mode)
+}
+
+// worker is the result of one goroutine.
+type worker struct {
+	ops      int64
+	bypassed int64
+	failed   int64
+	waits    map[priority.PriorityValue]*histogram
+}
+
+func run(cfg config, t target) []*worker {
+	// the priorities are picked with probability proportional to their weight.
+	var choices []priority.PriorityValue
+	for pr, weight := range cfg.mix {
+		for i := 0; i < weight; i++ {
+			choices = append(choices, pr)
+		}
+	}
+	sort.Slice(choices, func(a, b int) bool { return choices[a] < choices[b] })
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.duration)
+	defer cancel()
+	workers := make([]*worker, cfg.goroutines)
+	var wg sync.WaitGroup
+	for i := range workers {
+		w := &worker{waits: make(map[priority.PriorityValue]*histogram)}
+		workers[i] = w
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for ctx.Err() == nil {
+				pr := choices[r.Intn(len(choices))]
+				start := time.Now()
+				result, err := t.acquire(ctx, pr)
+				waited := time.Since(start)
+				if err != nil {
+					if ctx.Err() == nil {
+						w.failed++
+					}
+					continue
+				}
+				if result == limiter.AdmissionBypassed {
+					w.bypassed++
+				} else {
+					h := w.waits[pr]
+					if h == nil {
+						h = &histogram{}
+						w.waits[pr] = h
+					}
+					h.record(waited)
+				}
+				if cfg.hold > 0 {
+					time.Sleep(cfg.hold)
+				}
+				t.release(pr, result)
+				w.ops++
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+	return workers
+}
+
+func readMutexWait() (float64, bool) {
+	sample := []metrics.Sample{{Name: mutexWait}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindFloat64 {
+		return 0, false
+	}
+	return sample[0].Value.Float64(), true
+}
+
+func report(cfg config, workers []*worker, elapsed time.Duration, contention float64, contentionOK bool) {
+	var ops, bypassed, failed int64
+	waits := make(map[priority.PriorityValue]*histogram)
+	for _, w := range workers {
+		ops += w.ops
+		bypassed += w.bypassed
+		failed += w.failed
+		for pr, h := range w.waits {
+			if waits[pr] == nil {
+				waits[pr] = &histogram{}
+			}
+			waits[pr].merge(h)
+		}
+	}
+	fmt.Printf("mode %s  limit %d  goroutines %d  GOMAXPROCS %d  hold %v\n",
+		cfg.mode, cfg.limit, cfg.goroutines, runtime.GOMAXPROCS(0), cfg.hold)
+	fmt.Printf("operations %d  throughput %.0f ops/s  bypassed %d  failed %d\n",
+		ops, float64(ops)/elapsed.Seconds(), bypassed, failed)
+	if contentionOK {
+		fmt.Printf("mutex wait %v total , %v per operation\n",
+			seconds(contention), seconds(contention/float64(max(ops, 1))))
+	} else {
+		fmt.Println("mutex wait not supported by this Go version")
+	}
+
+	levels := make([]priority.PriorityValue, 0, len(waits))
+	for pr := range waits {
+		levels = append(levels, pr)
+	}
+	sort.Slice(levels, func(a, b int) bool { return levels[a] > levels[b] })
+	for _, pr := range levels {
+		if strings.HasPrefix(cfg.mode, "priority") {
+			fmt.Printf("\nwait latency , priority %d\n", pr)
+		} else {
+			fmt.Printf("\nwait latency\n")
+		}
+		waits[pr].write(os.Stdout)
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+func max(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+var errMix = errors.New("mix must be PRIORITY=WEIGHT pairs , e.g. low=3,high=1")
+
+var priorities = map[string]priority.PriorityValue{
+	"low":        priority.Low,
+	"medium":     priority.Medium,
+	"mediumhigh": priority.MediumHigh,
+	"high":       priority.High,
+}
+
+func parseMix(s string) (map[priority.PriorityValue]int, error) {
+	mix := make(map[priority.PriorityValue]int)
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, errMix
+		}
+		pr, ok := priorities[strings.ToLower(strings.TrimSpace(kv[0]))]
+		if !ok {
+			return nil, errMix
+		}
+		weight, err := strconv.Atoi(kv[1])
+		if err != nil || weight < 0 {
+			return nil, errMix
+		}
+		mix[pr] += weight
+	}
+	total := 0
+	for _, weight := range mix {
+		total += weight
+	}
+	if total == 0 {
+		return nil, errMix
+	}
+	return mix, nil
+}
+
+func main() {
+	var cfg config
+	flag.StringVar(&cfg.mode, "mode", "wait", "wait , bypass , priority or priority-bypass")
+	flag.IntVar(&cfg.limit, "limit", runtime.GOMAXPROCS(0), "number of concurrent slots")
+	flag.IntVar(&cfg.goroutines, "goroutines", 64, "number of goroutines")
+	flag.DurationVar(&cfg.duration, "duration", 5*time.Second, "how long to run")
+	flag.DurationVar(&cfg.hold, "hold", 0, "how long each goroutine holds the slot")
+	flag.DurationVar(&cfg.timeout, "timeout", 0, "wait timeout , required by the bypass modes")
+	mix := flag.String("mix", "low=1", "priority weights of the priority modes")
+	flag.Parse()
+
+	if strings.HasPrefix(cfg.mode, "priority") {
+		m, err := parseMix(*mix)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "limiterbench:", err)
+			os.Exit(2)
+		}
+		cfg.mix = m
+	} else {
+		cfg.mix = map[priority.PriorityValue]int{priority.Low: 1}
+	}
+	if strings.HasSuffix(cfg.mode, "bypass") && cfg.timeout <= 0 {
+		cfg.timeout = time.Millisecond
+	}
+	if cfg.limit <= 0 || cfg.goroutines <= 0 {
+		fmt.Fprintln(os.Stderr, "limiterbench: limit and goroutines must be positive")
+		os.Exit(2)
+	}
+	t, err := newTarget(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "limiterbench:", err)
+		os.Exit(2)
+	}
+
+	before, contentionOK := readMutexWait()
+	start := time.Now()
+	workers := run(cfg, t)
+	elapsed := time.Since(start)
+	after, _ := readMutexWait()
+	report(cfg, workers, elapsed, after-before, contentionOK)
+}
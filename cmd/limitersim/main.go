@@ -0,0 +1,132 @@
+// Command limitersim simulates a limiter configuration under a synthetic workload and reports the
+// wait percentiles , bypass and timeout rates of every class and the utilisation of the limiter.
+//
+//	limitersim -limit 4 -priority -aging 10ms -timeout 50ms \
+//		-class low:200:exp:5ms -class high:100:const:2ms
+//
+// A class is PRIORITY:RATE:DISTRIBUTION where the priority is low , medium , mediumhigh , high or
+// a number , the rate is the number of arrivals per second and the service time distribution is
+// const:D , exp:MEAN or uniform:MIN-MAX.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vivek-ng/concurrency-limiter/priority"
+	"github.com/vivek-ng/concurrency-limiter/sim"
+)
+
+type classes []sim.Class
+
+func (c *classes) String() string {
+	return fmt.Sprint(*c)
+}
+
+func (c *classes) Set(s string) error {
+	class, err := parseClass(s)
+	if err != nil {
+		return err
+	}
+	*c = append(*c, class)
+	return nil
+}
+
+var priorities = map[string]priority.PriorityValue{
+	"low":        priority.Low,
+	"medium":     priority.Medium,
+	"mediumhigh": priority.MediumHigh,
+	"high":       priority.High,
+}
+
+var errClass = errors.New("class must be PRIORITY:RATE:DISTRIBUTION , e.g. low:100:exp:5ms")
+
+func parseClass(s string) (sim.Class, error) {
+	parts := strings.SplitN(s, ":", 4)
+	if len(parts) != 4 {
+		return sim.Class{}, errClass
+	}
+	pr, ok := priorities[strings.ToLower(parts[0])]
+	if !ok {
+		n, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return sim.Class{}, errClass
+		}
+		pr = priority.PriorityValue(n)
+	}
+	rate, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return sim.Class{}, errClass
+	}
+	service, err := parseDistribution(parts[2], parts[3])
+	if err != nil {
+		return sim.Class{}, err
+	}
+	return sim.Class{Priority: pr, Rate: rate, Service: service}, nil
+}
+
+func parseDistribution(kind, arg string) (sim.Distribution, error) {
+	switch kind {
+	case "const":
+		d, err := time.ParseDuration(arg)
+		return sim.Constant(d), err
+	case "exp":
+		d, err := time.ParseDuration(arg)
+		return sim.Exponential(d), err
+	case "uniform":
+		bounds := strings.SplitN(arg, "-", 2)
+		if len(bounds) != 2 {
+			return nil, fmt.Errorf("uniform distribution must be MIN-MAX , got %q", arg)
+		}
+		min, err := time.ParseDuration(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		max, err := time.ParseDuration(bounds[1])
+		return sim.Uniform{Min: min, Max: max}, err
+	}
+	return nil, fmt.Errorf("unknown distribution %q , use const , exp or uniform", kind)
+}
+
+func main() {
+	var cfg sim.Config
+	var cs classes
+	flag.IntVar(&cfg.Limit, "limit", 4, "number of concurrent slots")
+	flag.BoolVar(&cfg.Priority, "priority", false, "simulate a priority limiter")
+	flag.DurationVar(&cfg.Timeout, "timeout", 0, "wait timeout , zero waits forever")
+	flag.DurationVar(&cfg.DynamicPeriod, "aging", 0, "dynamic priority period , requires -priority")
+	flag.BoolVar(&cfg.Bypass, "bypass", false, "bypass the limiter after the timeout")
+	flag.IntVar(&cfg.BypassBudget, "bypass-budget", 0, "maximum number of bypassed requests in flight , zero is unlimited")
+	flag.DurationVar(&cfg.Duration, "duration", 10*time.Second, "how long requests arrive , in virtual time")
+	flag.Int64Var(&cfg.Seed, "seed", 1, "random seed of the workload")
+	flag.Var(&cs, "class", "request class PRIORITY:RATE:DISTRIBUTION , may be repeated")
+	format := flag.String("format", "table", "output format , table or csv")
+	flag.Parse()
+
+	cfg.Classes = cs
+	if len(cfg.Classes) == 0 {
+		cfg.Classes = []sim.Class{{Priority: priority.Low, Rate: 100, Service: sim.Exponential(10 * time.Millisecond)}}
+	}
+	result, err := sim.Run(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "limitersim:", err)
+		os.Exit(2)
+	}
+	switch *format {
+	case "csv":
+		err = sim.WriteCSV(os.Stdout, result)
+	case "table":
+		err = sim.WriteTable(os.Stdout, result)
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "limitersim:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,156 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFastPathStress(t *testing.T) {
+	const limit = 4
+	l := New(limit)
+	var inFlight, maxInFlight int64
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	// pausing and resuming moves the limiter between the fast and the slow path.
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+				l.Pause()
+				l.Resume()
+			}
+		}
+	}()
+	for g := 0; g < 64; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for i := 0; i < 300; i++ {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.Intn(200))*time.Microsecond)
+				err := l.Wait(ctx)
+				cancel()
+				if err != nil {
+					continue
+				}
+				n := atomic.AddInt64(&inFlight, 1)
+				for {
+					m := atomic.LoadInt64(&maxInFlight)
+					if n <= m || atomic.CompareAndSwapInt64(&maxInFlight, m, n) {
+						break
+					}
+				}
+				if r.Intn(4) == 0 {
+					runtime.Gosched()
+				}
+				atomic.AddInt64(&inFlight, -1)
+				l.Finish()
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+	close(stop)
+	assert.LessOrEqual(t, maxInFlight, int64(limit))
+	assert.Equal(t, 0, l.Count())
+	assert.Equal(t, 0, l.waitListSize())
+	assert.Equal(t, int64(0), atomic.LoadInt64(&l.state)&slow)
+}
+
+func TestFastPathKeepsFIFO(t *testing.T) {
+	l := New(1)
+	ctx := context.Background()
+	assert.True(t, l.tryAcquire())
+
+	order := make(chan int, 10)
+	for i := 0; i < 10; i++ {
+		go func(i int) {
+			_ = l.Wait(ctx)
+			order <- i
+		}(i)
+		for l.waitListSize() != i+1 {
+			runtime.Gosched()
+		}
+	}
+	for i := 0; i < 10; i++ {
+		// a released slot is handed to the first waiter , new callers can't take it on the fast path.
+		l.Finish()
+		assert.False(t, l.tryAcquire())
+		assert.Equal(t, i, <-order)
+	}
+	l.Finish()
+	assert.True(t, l.tryAcquire())
+}
+
+var procs = []int{1, 2, 4, 8, 16, 32, 64}
+
+// BenchmarkWaitFinishUncontended acquires and releases from every P with more slots than goroutines.
+func BenchmarkWaitFinishUncontended(b *testing.B) {
+	for _, n := range procs {
+		b.Run(fmt.Sprintf("procs=%d", n), func(b *testing.B) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(n))
+			l := New(1 << 20)
+			ctx := context.Background()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_ = l.Wait(ctx)
+					l.Finish()
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkWaitFinishContended acquires and releases from every P with a single slot per two Ps.
+func BenchmarkWaitFinishContended(b *testing.B) {
+	for _, n := range procs {
+		b.Run(fmt.Sprintf("procs=%d", n), func(b *testing.B) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(n))
+			l := New((n + 1) / 2)
+			ctx := context.Background()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_ = l.Wait(ctx)
+					l.Finish()
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkMassCancellation cancels every goroutine of a full waitlist at once.
+func BenchmarkMassCancellation(b *testing.B) {
+	for _, n := range []int{1000, 10000} {
+		b.Run(fmt.Sprintf("waiters=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				l := New(1)
+				_ = l.Wait(context.Background())
+				ctx, cancel := context.WithCancel(context.Background())
+				var wg sync.WaitGroup
+				wg.Add(n)
+				for j := 0; j < n; j++ {
+					go func() {
+						defer wg.Done()
+						_ = l.Wait(ctx)
+					}()
+				}
+				for l.waitListSize() != n {
+					runtime.Gosched()
+				}
+				b.StartTimer()
+				cancel()
+				wg.Wait()
+			}
+		})
+	}
+}
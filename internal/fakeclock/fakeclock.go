@@ -0,0 +1,193 @@
+// Package fakeclock provides a limiter.Clock which only moves when it is advanced. It backs
+// limitertest.FakeClock and the virtual clock of the simulator , without depending on testing.
+package fakeclock
+
+import (
+	"sync"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+// Clock is a limiter.Clock which only moves when Advance is called.
+type Clock struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+	now     time.Time
+	timers  []*fakeTimer
+}
+
+// New returns a clock set to now.
+func New(now time.Time) *Clock {
+	c := &Clock{now: now}
+	c.changed = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer creates a timer which fires when the clock is advanced by d.
+func (c *Clock) NewTimer(d time.Duration) limiter.Timer {
+	return c.add(d, 0, nil)
+}
+
+// NewTicker creates a ticker which ticks every time the clock is advanced by d.
+// Like time.Ticker , ticks are dropped when the receiver is not keeping up.
+func (c *Clock) NewTicker(d time.Duration) limiter.Ticker {
+	return fakeTicker{c.add(d, d, nil)}
+}
+
+// AfterFunc calls f when the clock is advanced by d. Unlike time.AfterFunc , f is called by
+// Advance before it returns.
+func (c *Clock) AfterFunc(d time.Duration, f func()) limiter.Timer {
+	return c.add(d, 0, f)
+}
+
+func (c *Clock) add(d, period time.Duration, f func()) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{
+		clock:  c,
+		when:   c.now.Add(d),
+		period: period,
+		f:      f,
+	}
+	if f == nil {
+		t.ch = make(chan time.Time, 1)
+	}
+	c.timers = append(c.timers, t)
+	c.changed.Broadcast()
+	return t
+}
+
+// Advance moves the clock forward by d and fires the timers and tickers which are due , in the
+// order of their deadlines.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	for {
+		t := c.next(end)
+		if t == nil {
+			break
+		}
+		c.now = t.when
+		if t.period > 0 {
+			t.when = t.when.Add(t.period)
+		} else {
+			c.remove(t)
+		}
+		if t.f != nil {
+			c.mu.Unlock()
+			t.f()
+			c.mu.Lock()
+			continue
+		}
+		select {
+		case t.ch <- c.now:
+		default:
+		}
+	}
+	c.now = end
+	c.mu.Unlock()
+}
+
+// next returns the earliest timer due at end. Callers must hold c.mu.
+func (c *Clock) next(end time.Time) *fakeTimer {
+	var next *fakeTimer
+	for _, t := range c.timers {
+		if t.when.After(end) {
+			continue
+		}
+		if next == nil || t.when.Before(next.when) {
+			next = t
+		}
+	}
+	return next
+}
+
+// remove stops the timer and reports whether it was pending. Callers must hold c.mu.
+func (c *Clock) remove(t *fakeTimer) bool {
+	for i, pending := range c.timers {
+		if pending == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			c.changed.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+// Timers returns the number of pending timers and tickers.
+func (c *Clock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// Next returns when the earliest pending timer or ticker fires , it returns false if there is none.
+func (c *Clock) Next() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var next *fakeTimer
+	for _, t := range c.timers {
+		if next == nil || t.when.Before(next.when) {
+			next = t
+		}
+	}
+	if next == nil {
+		return time.Time{}, false
+	}
+	return next.when, true
+}
+
+// Undelivered returns the number of ticks which were not received yet.
+func (c *Clock) Undelivered() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, t := range c.timers {
+		n += len(t.ch)
+	}
+	return n
+}
+
+// BlockUntil waits until n timers and tickers are pending , e.g. until n goroutines with a
+// timeout are waiting for capacity.
+func (c *Clock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) < n {
+		c.changed.Wait()
+	}
+}
+
+type fakeTimer struct {
+	clock  *Clock
+	when   time.Time
+	period time.Duration
+	ch     chan time.Time
+	f      func()
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.clock.remove(t)
+}
+
+type fakeTicker struct {
+	*fakeTimer
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
@@ -0,0 +1,67 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Lease describes an acquisition which was held longer than the lease duration and was reclaimed.
+type Lease struct {
+	// Acquired is when the capacity was acquired.
+	Acquired time.Time
+	// Duration is the maximum hold duration of the lease.
+	Duration time.Duration
+	// Stack is the stack of the acquirer , only recorded when lease stacks are enabled.
+	Stack []byte
+}
+
+// Permit is capacity acquired from a limiter. It must be released exactly once with Release ,
+// further calls are ignored.
+type Permit struct {
+	mu       sync.Mutex
+	release  func()
+	released bool
+	timer    Timer
+}
+
+// NewPermit returns a permit which calls release when it is released. It is meant for limiter
+// implementations. If duration is positive the permit is a lease: it is released automatically
+// after duration and onExpire , if not nil , is called with the lease. The lease is timed by clock.
+func NewPermit(clock Clock, release func(), duration time.Duration, stack []byte, onExpire func(Lease)) *Permit {
+	p := &Permit{
+		release: release,
+	}
+	if duration > 0 {
+		lease := Lease{
+			Acquired: clock.Now(),
+			Duration: duration,
+			Stack:    stack,
+		}
+		// the timer may fire before it is stored , Release waits for the store.
+		p.mu.Lock()
+		p.timer = clock.AfterFunc(duration, func() {
+			if p.Release() && onExpire != nil {
+				onExpire(lease)
+			}
+		})
+		p.mu.Unlock()
+	}
+	return p
+}
+
+// Release gives the capacity back to the limiter. It returns false if the permit was already
+// released or its lease expired.
+func (p *Permit) Release() bool {
+	p.mu.Lock()
+	if p.released {
+		p.mu.Unlock()
+		return false
+	}
+	p.released = true
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.mu.Unlock()
+	p.release()
+	return true
+}
@@ -0,0 +1,62 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPermitReleasesOnce(t *testing.T) {
+	l := New(1)
+	permit, err := l.Acquire(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, l.Count())
+
+	assert.True(t, permit.Release())
+	assert.False(t, permit.Release())
+	assert.Zero(t, l.Count())
+}
+
+func TestExpiredLeaseIsReclaimed(t *testing.T) {
+	expired := make(chan Lease, 1)
+	l := New(1,
+		WithLeaseDuration(20*time.Millisecond),
+		WithLeaseExpiredHook(func(lease Lease) {
+			expired <- lease
+		}),
+		WithLeaseStacks(),
+	)
+
+	permit, err := l.Acquire(context.Background())
+	assert.NoError(t, err)
+
+	// the lease expires and the waiter gets the slot.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	next, err := l.Acquire(ctx)
+	assert.NoError(t, err)
+
+	lease := <-expired
+	assert.Equal(t, 20*time.Millisecond, lease.Duration)
+	assert.Contains(t, string(lease.Stack), "TestExpiredLeaseIsReclaimed")
+
+	// the late release is ignored.
+	assert.False(t, permit.Release())
+	assert.Equal(t, 1, l.Count())
+
+	assert.True(t, next.Release())
+	assert.Zero(t, l.Count())
+}
+
+func TestRunReleasesOnPanic(t *testing.T) {
+	l := New(1)
+
+	assert.PanicsWithValue(t, "boom", func() {
+		_ = l.Run(context.Background(), func() error {
+			panic("boom")
+		})
+	})
+	assert.Zero(t, l.Count())
+}
@@ -0,0 +1,58 @@
+package limitertest
+
+import (
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/internal/fakeclock"
+)
+
+// FakeClock is a limiter.Clock which only moves when Advance is called , so timeouts , aging and
+// leases can be tested without sleeping.
+type FakeClock struct {
+	clock *fakeclock.Clock
+}
+
+// NewFakeClock returns a fake clock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{clock: fakeclock.New(now)}
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	return c.clock.Now()
+}
+
+// NewTimer creates a timer which fires when the clock is advanced by d.
+func (c *FakeClock) NewTimer(d time.Duration) limiter.Timer {
+	return c.clock.NewTimer(d)
+}
+
+// NewTicker creates a ticker which ticks every time the clock is advanced by d.
+// Like time.Ticker , ticks are dropped when the receiver is not keeping up.
+func (c *FakeClock) NewTicker(d time.Duration) limiter.Ticker {
+	return c.clock.NewTicker(d)
+}
+
+// AfterFunc calls f when the clock is advanced by d. Unlike time.AfterFunc , f is called by
+// Advance on its goroutine before Advance returns , so don't hold locks f needs while calling Advance.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) limiter.Timer {
+	return c.clock.AfterFunc(d, f)
+}
+
+// Advance moves the clock forward by d and fires the timers and tickers which are due , in the
+// order of their deadlines.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.clock.Advance(d)
+}
+
+// Timers returns the number of pending timers and tickers.
+func (c *FakeClock) Timers() int {
+	return c.clock.Timers()
+}
+
+// BlockUntil waits until n timers and tickers are pending , e.g. until n goroutines with a
+// timeout are waiting for capacity.
+func (c *FakeClock) BlockUntil(n int) {
+	c.clock.BlockUntil(n)
+}
@@ -0,0 +1,49 @@
+package limitertest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock_Timer(t *testing.T) {
+	start := time.Unix(0, 0)
+	c := NewFakeClock(start)
+	timer := c.NewTimer(10 * time.Millisecond)
+	c.Advance(9 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+	c.Advance(time.Millisecond)
+	assert.Equal(t, start.Add(10*time.Millisecond), <-timer.C())
+	assert.False(t, timer.Stop())
+	assert.Equal(t, 0, c.Timers())
+}
+
+func TestFakeClock_TickerAndAfterFunc(t *testing.T) {
+	start := time.Unix(0, 0)
+	c := NewFakeClock(start)
+	ticker := c.NewTicker(10 * time.Millisecond)
+	var fired []time.Time
+	c.AfterFunc(15*time.Millisecond, func() {
+		fired = append(fired, c.Now())
+	})
+	stopped := c.AfterFunc(time.Millisecond, func() {
+		t.Fatal("stopped timer fired")
+	})
+	assert.True(t, stopped.Stop())
+
+	c.Advance(10 * time.Millisecond)
+	assert.Equal(t, start.Add(10*time.Millisecond), <-ticker.C())
+	c.Advance(20 * time.Millisecond)
+	assert.Equal(t, []time.Time{start.Add(15 * time.Millisecond)}, fired)
+	// the tick at 30ms was dropped as the tick at 20ms was not received.
+	assert.Equal(t, start.Add(20*time.Millisecond), <-ticker.C())
+	assert.Equal(t, start.Add(30*time.Millisecond), c.Now())
+
+	ticker.Stop()
+	assert.Equal(t, 0, c.Timers())
+}
@@ -0,0 +1,74 @@
+// Package limitertest provides helpers to test code which uses the concurrency limiters.
+package limitertest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+// Limiter is implemented by limiter.Limiter and priority.PriorityLimiter.
+type Limiter interface {
+	Count() int
+	Outstanding() []limiter.Acquisition
+}
+
+// AssertNoLeaks fails the test at cleanup if capacity of the limiter is still acquired.
+// Create the limiter with WithTracking to report the stacks of the outstanding acquisitions ,
+// the stacks of capacity acquired with Wait are the likely culprits rather than certain ones.
+//
+//	l := limiter.New(3, limiter.WithTracking())
+//	limitertest.AssertNoLeaks(t, l)
+func AssertNoLeaks(t testing.TB, l Limiter) {
+	t.Helper()
+	t.Cleanup(func() {
+		t.Helper()
+		if msg := Leaks(l); msg != "" {
+			t.Error(msg)
+		}
+	})
+}
+
+// Leaks describes the capacity of the limiter which is still acquired , or returns an empty
+// string if there is none.
+func Leaks(l Limiter) string {
+	count := l.Count()
+	if count == 0 {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "limiter: %d acquisition(s) not released", count)
+	acquisitions := l.Outstanding()
+	if acquisitions == nil {
+		b.WriteString(" , enable WithTracking to record their stacks")
+		return b.String()
+	}
+	for i, a := range acquisitions {
+		note := ""
+		if a.Approximate {
+			note = " (made with Wait , likely culprit)"
+		}
+		fmt.Fprintf(&b, "\n\nacquisition %d at %s%s:\n%s", i+1, a.Time.Format(time.RFC3339Nano), note, a.Stack)
+	}
+	if unattributed := count - len(acquisitions); unattributed > 0 {
+		fmt.Fprintf(&b, "\n\n%d acquisition(s) can't be attributed to a caller", unattributed)
+	}
+	if approximate(acquisitions) {
+		b.WriteString("\n\nFinish can't tell which Wait it releases and forgets the oldest ," +
+			" use Acquire or Run to record the exact stacks")
+	}
+	return b.String()
+}
+
+// approximate reports whether any of the acquisitions was made with Wait.
+func approximate(acquisitions []limiter.Acquisition) bool {
+	for _, a := range acquisitions {
+		if a.Approximate {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package limitertest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+)
+
+func leakyAcquire(l *limiter.Limiter) {
+	_, _ = l.Acquire(context.Background())
+}
+
+func balancedAcquire(l *limiter.Limiter) {
+	permit, _ := l.Acquire(context.Background())
+	permit.Release()
+}
+
+func TestLeaks_ReportsStacks(t *testing.T) {
+	l := limiter.New(3, limiter.WithTracking())
+	leakyAcquire(l)
+	balancedAcquire(l)
+
+	msg := Leaks(l)
+	assert.Contains(t, msg, "1 acquisition(s) not released")
+	assert.Contains(t, msg, "leakyAcquire")
+	assert.NotContains(t, msg, "balancedAcquire")
+	assert.NotContains(t, msg, "can't be attributed")
+	assert.Len(t, l.Outstanding(), 1)
+}
+
+func TestLeaks_ReleasedOutOfOrder(t *testing.T) {
+	l := limiter.New(3, limiter.WithTracking())
+	first, _ := l.Acquire(context.Background())
+	leakyAcquire(l)
+	first.Release()
+
+	acquisitions := l.Outstanding()
+	if assert.Len(t, acquisitions, 1) {
+		assert.Contains(t, string(acquisitions[0].Stack), "leakyAcquire")
+	}
+}
+
+func leakyWait(l *limiter.Limiter) {
+	_ = l.Wait(context.Background())
+}
+
+func TestLeaks_WaitIsAttributedApproximately(t *testing.T) {
+	l := limiter.New(3, limiter.WithTracking())
+	leakyWait(l)
+	_ = l.Wait(context.Background())
+	leakyAcquire(l)
+	l.Finish()
+
+	msg := Leaks(l)
+	assert.Contains(t, msg, "2 acquisition(s) not released")
+	assert.Contains(t, msg, "leakyAcquire")
+	assert.NotContains(t, msg, "leakyWait")
+	assert.Contains(t, msg, "made with Wait , likely culprit")
+	assert.Contains(t, msg, "forgets the oldest")
+	acquisitions := l.Outstanding()
+	if assert.Len(t, acquisitions, 2) {
+		assert.True(t, acquisitions[0].Approximate)
+		assert.Contains(t, string(acquisitions[0].Stack), "TestLeaks_WaitIsAttributedApproximately")
+		assert.False(t, acquisitions[1].Approximate)
+	}
+}
+
+func TestLeaks_WithoutTracking(t *testing.T) {
+	l := limiter.New(3)
+	_ = l.Wait(context.Background())
+	assert.Contains(t, Leaks(l), "enable WithTracking")
+	assert.Nil(t, l.Outstanding())
+	l.Finish()
+	assert.Empty(t, Leaks(l))
+}
+
+func TestLeaks_PriorityLimiter(t *testing.T) {
+	p := priority.NewLimiter(1, priority.WithTracking())
+	permit, err := p.Acquire(context.Background(), priority.High)
+	assert.NoError(t, err)
+	ticket := p.Enqueue(priority.Low)
+	go permit.Release()
+	assert.NoError(t, ticket.Wait(context.Background()))
+	assert.NoError(t, ticket.Wait(context.Background()))
+
+	acquisitions := p.Outstanding()
+	if assert.Len(t, acquisitions, 1) {
+		assert.Contains(t, string(acquisitions[0].Stack), "TestLeaks_PriorityLimiter")
+	}
+	ticket.Finish()
+	assert.Empty(t, Leaks(p))
+	assert.Empty(t, p.Outstanding())
+}
+
+func TestLeaks_PriorityLimiterWait(t *testing.T) {
+	p := priority.NewLimiter(2, priority.WithTracking())
+	assert.NoError(t, p.Wait(context.Background(), priority.High))
+	assert.NoError(t, p.WaitCtx(context.Background()))
+
+	acquisitions := p.Outstanding()
+	if assert.Len(t, acquisitions, 2) {
+		assert.True(t, acquisitions[0].Approximate)
+		assert.Contains(t, string(acquisitions[0].Stack), "TestLeaks_PriorityLimiterWait")
+	}
+	assert.Contains(t, Leaks(p), "likely culprit")
+	p.FinishPriority(priority.High)
+	p.FinishCtx(context.Background())
+	assert.Empty(t, Leaks(p))
+	assert.Empty(t, p.Outstanding())
+}
+
+func TestAssertNoLeaks(t *testing.T) {
+	l := limiter.New(2, limiter.WithTracking())
+	AssertNoLeaks(t, l)
+	err := l.Run(context.Background(), func() error {
+		return nil
+	})
+	assert.NoError(t, err)
+
+	var leaked bool
+	t.Run("leak", func(t *testing.T) {
+		inner := &recorder{T: t}
+		l := limiter.New(2, limiter.WithTracking())
+		// cleanups run last in first out , record the result after AssertNoLeaks checked.
+		t.Cleanup(func() {
+			leaked = inner.failed
+		})
+		AssertNoLeaks(inner, l)
+		_ = l.Wait(context.Background())
+	})
+	assert.True(t, leaked)
+}
+
+// recorder records failures instead of failing the test.
+type recorder struct {
+	*testing.T
+	failed bool
+}
+
+func (r *recorder) Error(args ...interface{}) {
+	r.failed = true
+}
@@ -0,0 +1,176 @@
+package priority
+
+import (
+	"context"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/queue"
+)
+
+// asyncWait is the state of a caller waiting through AcquireAsync. It is guarded by p.mu.
+type asyncWait struct {
+	callback    func(*limiter.Permit, error)
+	executor    func(func())
+	priority    PriorityValue
+	start       time.Time
+	position    int
+	acquisition limiter.Acquisition
+	timer       limiter.Timer
+	aging       limiter.Timer
+	stopCtx     func() bool
+}
+
+// stop releases the timers and the context registration of the waiter.
+func (a *asyncWait) stop() {
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	if a.aging != nil {
+		a.aging.Stop()
+	}
+	if a.stopCtx != nil {
+		a.stopCtx()
+	}
+}
+
+// WithExecutor configures how AcquireAsync invokes its callbacks , e.g. by posting them to an
+// event loop. The executor is never called while the limiter is locked. By default every callback
+// runs in its own goroutine.
+func WithExecutor(executor func(func())) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.executor = executor
+	}
+}
+
+func goExecutor(f func()) {
+	go f()
+}
+
+// AcquireAsync is like Acquire but it does not block the calling goroutine , and waiting callers
+// don't hold a goroutine. The callback is invoked once through the executor: with a permit when a
+// slot is granted , or with a *limiter.AdmissionError when the timeout elapses , the context is
+// done , the caller is rejected or shed , or the limiter is closed. Dynamic priority applies to
+// the queued callers like to waiting goroutines.
+func (p *PriorityLimiter) AcquireAsync(ctx context.Context, priority PriorityValue, callback func(*limiter.Permit, error)) {
+	p.acquireAsync(ctx, priority, callback, p.executor)
+}
+
+// acquireAsync is AcquireAsync with the executor of the callback.
+func (p *PriorityLimiter) acquireAsync(ctx context.Context, priority PriorityValue, callback func(*limiter.Permit, error), executor func(func())) {
+	a := &asyncWait{
+		callback: callback,
+		executor: executor,
+		priority: priority,
+		start:    p.clock.Now(),
+	}
+	a.acquisition = p.acquisition()
+	deadline, _ := ctx.Deadline()
+	if !deadline.IsZero() && p.unattainable(deadline) {
+		p.fail(a, limiter.AdmissionExpired, limiter.ErrDeadlineUnattainable)
+		return
+	}
+	ok, w, position, err := p.enqueue(priority, deadline, a)
+	if ok {
+		p.grant(a)
+		return
+	}
+	if err != nil {
+		a.position = position
+		p.fail(a, enqueueOutcome(err), err)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.unlock()
+	if _, queued := p.async[w]; !queued {
+		// admitted or removed already , the waiter is notified when the lock is released.
+		return
+	}
+	if p.timeout != nil {
+		a.timer = p.clock.AfterFunc(*p.timeout, func() {
+			p.abandon(w, a, limiter.AdmissionTimedOut, limiter.ErrTimeout)
+		})
+	}
+	if p.dynamicPeriod != nil {
+		a.aging = p.clock.AfterFunc(*p.dynamicPeriod, func() {
+			p.age(w, a)
+		})
+	}
+	a.stopCtx = context.AfterFunc(ctx, func() {
+		p.abandon(w, a, limiter.AdmissionCanceled, ctx.Err())
+	})
+}
+
+// age raises the priority of a queued asynchronous waiter every dynamic priority period.
+func (p *PriorityLimiter) age(w *queue.Item, a *asyncWait) {
+	p.mu.Lock()
+	defer p.unlock()
+	if _, queued := p.async[w]; !queued || w.Priority >= int(High) {
+		return
+	}
+	p.queue.Update(w, w.Priority+1)
+	p.dispatch()
+	if _, queued := p.async[w]; queued && w.Priority < int(High) {
+		a.aging = p.clock.AfterFunc(*p.dynamicPeriod, func() {
+			p.age(w, a)
+		})
+	}
+}
+
+// abandon removes an asynchronous waiter whose timeout elapsed or whose context is done.
+func (p *PriorityLimiter) abandon(w *queue.Item, a *asyncWait, outcome limiter.AdmissionResult, err error) {
+	if !p.removeWaiter(w) {
+		return
+	}
+	a.stop()
+	p.fail(a, outcome, err)
+}
+
+// fail invokes the callback of an asynchronous caller which was not admitted.
+func (p *PriorityLimiter) fail(a *asyncWait, outcome limiter.AdmissionResult, err error) {
+	admissionErr := p.admissionError(outcome, err, a.start, a.position)
+	a.executor(func() {
+		a.callback(nil, admissionErr)
+	})
+}
+
+// grant hands an acquired slot to an asynchronous caller.
+func (p *PriorityLimiter) grant(a *asyncWait) {
+	permit := p.permit(a.priority, a.acquisition)
+	a.executor(func() {
+		a.callback(permit, nil)
+	})
+}
+
+// signal wakes the waiter after it left the waitlist. Asynchronous waiters are notified once p.mu
+// is released. Callers must hold p.mu.
+func (p *PriorityLimiter) signal(w *queue.Item) {
+	close(w.Done)
+	if a, ok := p.async[w]; ok {
+		delete(p.async, w)
+		p.pending = append(p.pending, func() {
+			p.notify(w, a)
+		})
+	}
+}
+
+// notify completes an asynchronous waiter which was admitted or removed by another goroutine.
+func (p *PriorityLimiter) notify(w *queue.Item, a *asyncWait) {
+	a.stop()
+	if outcome, removed := p.takeRemoved(w); removed {
+		p.fail(a, outcome, outcomeErrors[outcome])
+		return
+	}
+	p.grant(a)
+}
+
+// unlock releases p.mu and notifies the asynchronous waiters which were signaled while it was held.
+func (p *PriorityLimiter) unlock() {
+	pending := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+	for _, f := range pending {
+		f()
+	}
+}
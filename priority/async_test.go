@@ -0,0 +1,137 @@
+package priority
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/limitertest"
+)
+
+func TestPriorityAcquireAsync_PriorityOrder(t *testing.T) {
+	nl := NewLimiter(1, WithExecutor(limiter.Inline))
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, High))
+
+	var order []PriorityValue
+	for _, pr := range []PriorityValue{Low, High, Medium} {
+		pr := pr
+		nl.AcquireAsync(ctx, pr, func(p *limiter.Permit, err error) {
+			assert.NoError(t, err)
+			order = append(order, pr)
+			// the executor is not called while the limiter is locked , so the callback can release.
+			p.Release()
+		})
+	}
+	assert.Equal(t, 3, nl.waitListSize())
+	assert.Empty(t, order)
+
+	nl.Finish()
+	assert.Equal(t, []PriorityValue{High, Medium, Low}, order)
+	assert.Equal(t, 0, nl.Count())
+}
+
+func TestPriorityAcquireAsync_Canceled(t *testing.T) {
+	nl := NewLimiter(1)
+	assert.NoError(t, nl.Wait(context.Background(), High))
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	nl.AcquireAsync(ctx, Low, func(p *limiter.Permit, err error) {
+		assert.Nil(t, p)
+		errs <- err
+	})
+	cancel()
+	err := <-errs
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, limiter.AdmissionCanceled, limiter.Outcome(err))
+	assert.Equal(t, 0, nl.waitListSize())
+
+	nl.Finish()
+	assert.Equal(t, 0, nl.Count())
+}
+
+func TestPriorityAcquireAsync_Closed(t *testing.T) {
+	nl := NewLimiter(1, WithExecutor(limiter.Inline))
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, High))
+	var outcomes []limiter.AdmissionResult
+	nl.AcquireAsync(ctx, Low, func(p *limiter.Permit, err error) {
+		outcomes = append(outcomes, limiter.Outcome(err))
+	})
+	nl.Close()
+	nl.AcquireAsync(ctx, Low, func(p *limiter.Permit, err error) {
+		outcomes = append(outcomes, limiter.Outcome(err))
+	})
+	assert.Equal(t, []limiter.AdmissionResult{limiter.AdmissionClosed, limiter.AdmissionClosed}, outcomes)
+}
+
+func TestPriorityAcquireAsync_FakeClockTimeout(t *testing.T) {
+	clock := limitertest.NewFakeClock(time.Now())
+	nl := NewLimiter(1,
+		WithTimeoutDuration(10*time.Millisecond),
+		WithClock(clock),
+		WithExecutor(limiter.Inline),
+	)
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, High))
+
+	var err error
+	nl.AcquireAsync(ctx, Low, func(p *limiter.Permit, e error) {
+		err = e
+	})
+	clock.Advance(9 * time.Millisecond)
+	assert.NoError(t, err)
+	clock.Advance(time.Millisecond)
+
+	var admissionErr *limiter.AdmissionError
+	if assert.True(t, errors.As(err, &admissionErr)) {
+		assert.Equal(t, limiter.AdmissionTimedOut, admissionErr.Result)
+		assert.Equal(t, 10*time.Millisecond, admissionErr.Waited)
+	}
+	assert.Equal(t, 0, nl.waitListSize())
+	assert.Equal(t, 0, clock.Timers())
+}
+
+func TestPriorityAcquireAsync_FakeClockAging(t *testing.T) {
+	clock := limitertest.NewFakeClock(time.Now())
+	nl := NewLimiter(1,
+		WithDynamicPriorityDuration(10*time.Millisecond),
+		WithClock(clock),
+		WithExecutor(limiter.Inline),
+	)
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, High))
+
+	acquired := false
+	nl.AcquireAsync(ctx, Low, func(p *limiter.Permit, err error) {
+		assert.NoError(t, err)
+		acquired = true
+	})
+	for _, expected := range []PriorityValue{Medium, MediumHigh, High} {
+		clock.Advance(10 * time.Millisecond)
+		assert.Equal(t, int(expected), nl.queue.Front().Priority)
+	}
+	// the waiter reached the highest priority , it is not aged any more.
+	assert.Equal(t, 0, clock.Timers())
+
+	ticket := nl.Enqueue(High)
+	nl.Finish()
+	assert.True(t, acquired)
+	assert.False(t, ticket.Acquired())
+	assert.True(t, ticket.Cancel())
+}
+
+func TestPriorityAcquireAsync_Tracking(t *testing.T) {
+	nl := NewLimiter(1, WithTracking(), WithExecutor(limiter.Inline))
+	var permit *limiter.Permit
+	nl.AcquireAsync(context.Background(), Medium, func(p *limiter.Permit, err error) {
+		assert.NoError(t, err)
+		permit = p
+	})
+	assert.Len(t, nl.Outstanding(), 1)
+	assert.True(t, permit.Release())
+	limitertest.AssertNoLeaks(t, nl)
+}
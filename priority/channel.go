@@ -0,0 +1,21 @@
+package priority
+
+import (
+	"context"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+// AcquireChan starts acquiring capacity with the given priority and returns a channel , so the
+// caller can wait for it in a select alongside other channels. The channel receives the permit
+// once capacity is granted and is closed without a permit when the caller is not admitted.
+//
+// cancel must be called once the caller stops waiting , it is safe to call it more than once. It
+// abandons the acquisition and releases a permit which was granted but not received. A received
+// permit must still be released by the caller. cancel returns the *limiter.AdmissionError when the
+// caller was not admitted.
+func (p *PriorityLimiter) AcquireChan(ctx context.Context, priority PriorityValue) (<-chan *limiter.Permit, func() error) {
+	return limiter.PermitChan(ctx, func(ctx context.Context, callback func(*limiter.Permit, error)) {
+		p.acquireAsync(ctx, priority, callback, limiter.Inline)
+	})
+}
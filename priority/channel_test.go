@@ -0,0 +1,71 @@
+package priority
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+func TestPriorityAcquireChan_PriorityOrder(t *testing.T) {
+	nl := NewLimiter(1)
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, High))
+
+	low, cancelLow := nl.AcquireChan(ctx, Low)
+	defer cancelLow()
+	high, cancelHigh := nl.AcquireChan(ctx, High)
+	defer cancelHigh()
+
+	nl.Finish()
+	permit := <-high
+	select {
+	case <-low:
+		t.Fatal("low priority admitted before high priority")
+	default:
+	}
+	permit.Release()
+	permit = <-low
+	permit.Release()
+	assert.Equal(t, 0, nl.Count())
+}
+
+func TestPriorityAcquireChan_NotAdmitted(t *testing.T) {
+	nl := NewLimiter(1)
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, High))
+
+	permits, cancel := nl.AcquireChan(ctx, Low)
+	nl.Close()
+	_, ok := <-permits
+	assert.False(t, ok)
+	assert.Equal(t, limiter.AdmissionClosed, limiter.Outcome(cancel()))
+}
+
+func TestPriorityAcquireChan_AbandonRace(t *testing.T) {
+	nl := NewLimiter(2)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				permits, cancel := nl.AcquireChan(ctx, PriorityValue(j%4+1))
+				select {
+				case permit := <-permits:
+					permit.Release()
+				case <-time.After(time.Duration((i+j)%3) * time.Microsecond):
+				}
+				_ = cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Eventually(t, func() bool {
+		return nl.Count() == 0 && nl.waitListSize() == 0
+	}, time.Second, time.Millisecond)
+}
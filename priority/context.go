@@ -0,0 +1,49 @@
+package priority
+
+import "context"
+
+type contextKey struct{}
+
+// WithContextPriority returns a copy of ctx carrying the given priority.
+// Middleware can set the priority once and deeper code can call WaitCtx or RunCtx.
+func WithContextPriority(ctx context.Context, priority PriorityValue) context.Context {
+	return context.WithValue(ctx, contextKey{}, priority)
+}
+
+// FromContext returns the priority stored in ctx by WithContextPriority.
+func FromContext(ctx context.Context) (PriorityValue, bool) {
+	priority, ok := ctx.Value(contextKey{}).(PriorityValue)
+	return priority, ok
+}
+
+// WithDefaultPriority configures the priority used by WaitCtx and RunCtx when the context
+// does not carry one. The default is Low.
+func WithDefaultPriority(priority PriorityValue) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.defaultPriority = priority
+	}
+}
+
+// contextPriority returns the priority stored in ctx or the configured default.
+func (p *PriorityLimiter) contextPriority(ctx context.Context) PriorityValue {
+	if priority, ok := FromContext(ctx); ok {
+		return priority
+	}
+	return p.defaultPriority
+}
+
+// WaitCtx is like Wait but reads the priority from the context.
+// Release the slot with FinishCtx using the same context.
+func (p *PriorityLimiter) WaitCtx(ctx context.Context) error {
+	return p.Wait(ctx, p.contextPriority(ctx))
+}
+
+// FinishCtx releases a slot acquired by WaitCtx with the same context.
+func (p *PriorityLimiter) FinishCtx(ctx context.Context) {
+	p.FinishPriority(p.contextPriority(ctx))
+}
+
+// RunCtx is like Run but reads the priority from the context.
+func (p *PriorityLimiter) RunCtx(ctx context.Context, callback func() error) error {
+	return p.Run(ctx, p.contextPriority(ctx), callback)
+}
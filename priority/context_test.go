@@ -0,0 +1,49 @@
+package priority
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	priority, ok := FromContext(WithContextPriority(context.Background(), High))
+	assert.True(t, ok)
+	assert.Equal(t, High, priority)
+}
+
+func TestRunCtxUsesContextPriority(t *testing.T) {
+	nl := NewLimiter(1)
+	ctx := WithContextPriority(context.Background(), MediumHigh)
+
+	err := nl.RunCtx(ctx, func() error {
+		assert.Equal(t, map[PriorityValue]int{MediumHigh: 1}, nl.Stats().InUseByPriority)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Zero(t, nl.Count())
+}
+
+func TestWaitCtxUsesDefaultPriority(t *testing.T) {
+	nl := NewLimiter(1, WithDefaultPriority(Medium))
+	ctx := context.Background()
+
+	assert.NoError(t, nl.WaitCtx(ctx))
+	assert.Equal(t, map[PriorityValue]int{Medium: 1}, nl.Stats().InUseByPriority)
+
+	ok, w := nl.proceed(Low)
+	assert.False(t, ok)
+
+	nl.FinishCtx(ctx)
+	select {
+	case <-w.Done:
+	default:
+		t.Fatal("expected waiter to be admitted")
+	}
+	assert.Equal(t, map[PriorityValue]int{Low: 1}, nl.Stats().InUseByPriority)
+}
@@ -0,0 +1,130 @@
+package priority
+
+import (
+	"context"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+// ErrPreempted is returned by RunPreemptible when the slot was reclaimed for a higher priority goroutine.
+// It is the same error as limiter.ErrPreempted.
+var ErrPreempted = limiter.ErrPreempted
+
+// holder is a goroutine holding a slot acquired through RunPreemptible.
+type holder struct {
+	priority PriorityValue
+	cancel   context.CancelFunc
+
+	// guarded by PriorityLimiter.mu
+	preempted bool
+	// reclaimed is set when the grace period expired and the slot was counted as free.
+	reclaimed bool
+	timer     limiter.Timer
+}
+
+// WithPreemption lets a goroutine which has to wait preempt a lower priority goroutine
+// holding a slot acquired through RunPreemptible. The context passed to the preempted callback
+// is cancelled and the slot is handed to the waitlist once the callback returns.
+func WithPreemption() func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.preemption = true
+	}
+}
+
+// WithPreemptionGracePeriod configures how long a preempted callback can keep running before
+// its slot is forcibly counted as free. Without a grace period the slot is only freed when
+// the callback returns.
+func WithPreemptionGracePeriod(gracePeriod time.Duration) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.gracePeriod = gracePeriod
+	}
+}
+
+// RunPreemptible is like Run but the callback receives a context which is cancelled when the
+// slot is reclaimed for a higher priority goroutine. In that case RunPreemptible returns a
+// *limiter.AdmissionError with the limiter.AdmissionPreempted outcome wrapping ErrPreempted.
+// Preemption must be enabled with WithPreemption.
+func (p *PriorityLimiter) RunPreemptible(ctx context.Context,
+	priority PriorityValue,
+	callback func(ctx context.Context) error) (err error) {
+	start := p.clock.Now()
+	if _, err = p.wait(ctx, priority, false); err != nil {
+		return err
+	}
+	acquisition := p.record(p.acquisition())
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	h := &holder{
+		priority: priority,
+		cancel:   cancel,
+	}
+	p.mu.Lock()
+	p.holders = append(p.holders, h)
+	p.unlock()
+	// the slot is released even if the callback panics.
+	defer func() {
+		p.mu.Lock()
+		defer p.unlock()
+		p.removeHolder(h)
+		if acquisition != nil {
+			p.acquisitions.Remove(acquisition)
+		}
+		if h.timer != nil {
+			h.timer.Stop()
+		}
+		if !h.reclaimed {
+			p.release(priority)
+		}
+		if h.preempted {
+			err = p.admissionError(limiter.AdmissionPreempted, ErrPreempted, start, 0)
+		}
+	}()
+
+	return callback(runCtx)
+}
+
+// preempt cancels the lowest priority holder below the given priority. Among holders with the
+// same priority the most recent one is chosen , as it has done the least work.
+// Callers must hold p.mu.
+func (p *PriorityLimiter) preempt(priority PriorityValue) {
+	var victim *holder
+	for _, h := range p.holders {
+		if h.preempted || h.priority >= priority {
+			continue
+		}
+		if victim == nil || h.priority <= victim.priority {
+			victim = h
+		}
+	}
+	if victim == nil {
+		return
+	}
+	victim.preempted = true
+	victim.cancel()
+	if p.gracePeriod > 0 {
+		victim.timer = p.clock.AfterFunc(p.gracePeriod, func() {
+			p.mu.Lock()
+			defer p.unlock()
+			if p.removeHolder(victim) {
+				victim.reclaimed = true
+				p.release(victim.priority)
+			}
+		})
+	}
+}
+
+// removeHolder removes the holder and reports whether it was still registered.
+// Callers must hold p.mu.
+func (p *PriorityLimiter) removeHolder(h *holder) bool {
+	for i, candidate := range p.holders {
+		if candidate == h {
+			copy(p.holders[i:], p.holders[i+1:])
+			p.holders[len(p.holders)-1] = nil
+			p.holders = p.holders[:len(p.holders)-1]
+			return true
+		}
+	}
+	return false
+}
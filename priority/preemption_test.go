@@ -0,0 +1,129 @@
+package priority
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+func TestPreemptionCancelsLowPriorityHolder(t *testing.T) {
+	nl := NewLimiter(1, WithPreemption())
+
+	started := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- nl.RunPreemptible(context.Background(), Low, func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, nl.Wait(ctx, High))
+	err := <-done
+	assert.True(t, errors.Is(err, ErrPreempted))
+	assert.Equal(t, limiter.AdmissionPreempted, limiter.Outcome(err))
+	assert.Equal(t, map[PriorityValue]int{High: 1}, nl.Stats().InUseByPriority)
+
+	nl.FinishPriority(High)
+	assert.Zero(t, nl.Count())
+}
+
+func TestPreemptionDoesNotPreemptSamePriority(t *testing.T) {
+	nl := NewLimiter(1, WithPreemption(), WithTimeoutDuration(30*time.Millisecond))
+
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- nl.RunPreemptible(context.Background(), High, func(ctx context.Context) error {
+			<-release
+			return ctx.Err()
+		})
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	assert.Error(t, nl.Wait(context.Background(), High))
+	close(release)
+	assert.NoError(t, <-done)
+	assert.Zero(t, nl.Count())
+}
+
+func TestPreemptionDoesNotPreemptWhilePaused(t *testing.T) {
+	nl := NewLimiter(2, WithPreemption())
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- nl.RunPreemptible(context.Background(), Low, func(ctx context.Context) error {
+			close(started)
+			select {
+			case <-release:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	<-started
+
+	// High waits because admission is paused , preempting Low would not admit it.
+	nl.Pause()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Error(t, nl.Wait(ctx, High))
+
+	close(release)
+	assert.NoError(t, <-done)
+	nl.Resume()
+	assert.Zero(t, nl.Count())
+}
+
+func TestPreemptionGracePeriodFreesSlot(t *testing.T) {
+	nl := NewLimiter(1, WithPreemption(), WithPreemptionGracePeriod(20*time.Millisecond))
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- nl.RunPreemptible(context.Background(), Low, func(ctx context.Context) error {
+			close(started)
+			// ignores the cancellation.
+			<-release
+			return nil
+		})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, nl.Wait(ctx, High))
+	assert.Equal(t, 1, nl.Count())
+
+	close(release)
+	assert.True(t, errors.Is(<-done, ErrPreempted))
+	assert.Equal(t, 1, nl.Count())
+
+	nl.FinishPriority(High)
+	assert.Zero(t, nl.Count())
+}
+
+func TestRunPreemptibleReleasesOnPanic(t *testing.T) {
+	nl := NewLimiter(1, WithPreemption())
+	assert.Panics(t, func() {
+		_ = nl.RunPreemptible(context.Background(), Low, func(ctx context.Context) error {
+			panic("boom")
+		})
+	})
+	assert.Zero(t, nl.Count())
+	nl.mu.Lock()
+	assert.Empty(t, nl.holders)
+	nl.mu.Unlock()
+}
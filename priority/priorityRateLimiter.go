@@ -1,8 +1,12 @@
 package priority
 
 import (
-	"container/heap"
+	"container/list"
 	"context"
+	"errors"
+	"math"
+	"runtime/debug"
+	"sort"
 	"sync"
 	"time"
 
@@ -25,13 +29,25 @@ const (
 	High PriorityValue = 4
 )
 
+// DeadlineMode defines how context deadlines order the waitlist.
+type DeadlineMode int
+
+const (
+	// DeadlineTieBreak orders waiters of the same priority by their context deadline.
+	DeadlineTieBreak DeadlineMode = iota + 1
+	// DeadlineFirst orders all waiters by their context deadline (earliest deadline first).
+	// Priority only breaks ties between waiters with the same deadline.
+	DeadlineFirst
+)
+
 // PriorityLimiter stores the configuration need for priority concurrency limiter....
 type PriorityLimiter struct {
 	count int
 	// Deprecated: configure via NewLimiter. Runtime behavior uses an internal snapshot.
-	Limit    int
-	mu       sync.Mutex
-	waitList queue.PriorityQueue
+	Limit int
+	mu    sync.Mutex
+	// queue is the waitlist , a queue.Heap unless WithBucketQueue is used.
+	queue waitQueue
 	// Deprecated: configure via WithDynamicPriorityDuration. Runtime behavior uses an internal snapshot.
 	DynamicPeriod *int
 	// Deprecated: configure via WithTimeoutDuration. Runtime behavior uses an internal snapshot.
@@ -40,6 +56,78 @@ type PriorityLimiter struct {
 	limit         int
 	dynamicPeriod *time.Duration
 	timeout       *time.Duration
+	weights       map[PriorityValue]int
+	credits       map[PriorityValue]int
+	reservations  map[PriorityValue]int
+	// reservedLevels are the levels of reservations , highest first.
+	reservedLevels []PriorityValue
+	caps           map[PriorityValue]int
+	// classes stores the priority each waiter asked for, aging does not change it.
+	classes map[*queue.Item]PriorityValue
+	// deadlines stores the context deadline of the waiters which have one. It is checked against
+	// the service time , the waitlist is only ordered by it when a deadline mode is set.
+	deadlines map[*queue.Item]time.Time
+	inUse     map[PriorityValue]int
+	// defaultPriority is used by WaitCtx and RunCtx when the context carries no priority.
+	defaultPriority PriorityValue
+	deadlineMode    DeadlineMode
+	serviceTime     time.Duration
+	// removed stores why waiters were removed from the waitlist by other goroutines ,
+	// e.g. because their deadline became unattainable or they were shed.
+	removed    map[*queue.Item]limiter.AdmissionResult
+	maxWaiting int
+	// bypassing is the number of bypassed goroutines which did not call FinishBypass yet.
+	bypassing    int
+	bypassBudget int
+	closed       bool
+	paused       bool
+	// pauseExempt is the lowest priority still admitted while paused , zero admits none.
+	pauseExempt PriorityValue
+	// idle is closed once the limiter is closed and the count reached zero.
+	idle chan struct{}
+
+	leaseDuration time.Duration
+	leaseStacks   bool
+	onLeaseExpire func(limiter.Lease)
+	// holders are the preemptible slot holders in acquisition order.
+	holders     []*holder
+	preemption  bool
+	gracePeriod time.Duration
+
+	tracking bool
+	// acquisitions are the limiter.Acquisition values of the slots which were not released yet.
+	acquisitions list.List
+	// waits are the elements of acquisitions made with Wait , oldest first.
+	waits list.List
+
+	clock limiter.Clock
+
+	executor func(func())
+	// async stores the state of the waiters queued by AcquireAsync.
+	async map[*queue.Item]*asyncWait
+	// pending are the notifications of asynchronous waiters , run by unlock.
+	pending []func()
+}
+
+// Stats is a point in time snapshot of the limiter usage.
+type Stats struct {
+	// Limit is the total number of slots.
+	Limit int
+	// InUse is the number of slots currently acquired.
+	InUse int
+	// Waiting is the number of goroutines in the waitlist.
+	Waiting int
+	// Reserved is the number of slots reserved for priority levels configured via WithReservation.
+	Reserved int
+	// ReservedInUse is the number of reserved slots currently acquired. Slots held by a reserved
+	// level are counted against its reservation first.
+	ReservedInUse int
+	// SharedInUse is the number of shared slots currently acquired.
+	SharedInUse int
+	// InUseByPriority is the number of slots currently acquired by each priority level.
+	InUseByPriority map[PriorityValue]int
+	// Bypassed is the number of bypassed goroutines in flight.
+	Bypassed int
 }
 
 // Option is a type to configure the Limiter struct....
@@ -48,18 +136,33 @@ type Option func(*PriorityLimiter)
 // NewLimiter creates an instance of *PriorityLimiter. Configure the Limiter with the options specified.
 // Example: priority.NewLimiter(4, WithDynamicPriorityDuration(5*time.Millisecond))
 func NewLimiter(limit int, options ...Option) *PriorityLimiter {
-	pq := make(queue.PriorityQueue, 0)
 	nl := &PriorityLimiter{
-		Limit:    limit,
-		waitList: pq,
-		limit:    limit,
+		Limit:     limit,
+		limit:     limit,
+		classes:   make(map[*queue.Item]PriorityValue),
+		deadlines: make(map[*queue.Item]time.Time),
+		inUse:     make(map[PriorityValue]int),
+		removed:   make(map[*queue.Item]limiter.AdmissionResult),
+		clock:     limiter.RealClock(),
+		async:     make(map[*queue.Item]*asyncWait),
+		executor:  goExecutor,
+
+		defaultPriority: Low,
 	}
 
 	for _, o := range options {
 		o(nl)
 	}
 
-	heap.Init(&pq)
+	if nl.queue == nil {
+		nl.queue = newHeapQueue()
+	}
+	for level := range nl.reservations {
+		nl.reservedLevels = append(nl.reservedLevels, level)
+	}
+	sort.Slice(nl.reservedLevels, func(i, j int) bool {
+		return nl.reservedLevels[i] > nl.reservedLevels[j]
+	})
 	return nl
 }
 
@@ -78,6 +181,140 @@ func WithDynamicPriorityDuration(dynamicPeriod time.Duration) func(*PriorityLimi
 	}
 }
 
+// WithWeightedFairQueueing replaces strict priority ordering with weighted fair queueing.
+// Released slots are shared between the waiting priority classes in proportion to their weights,
+// e.g. {High: 60, Medium: 30, Low: 10}. Classes with no waiters are skipped, so their share is
+// redistributed among the classes that are waiting. Classes without a positive weight are only
+// admitted when no weighted class is waiting. Within a class the FIFO order is followed.
+func WithWeightedFairQueueing(weights map[PriorityValue]int) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.weights = make(map[PriorityValue]int, len(weights))
+		for class, weight := range weights {
+			p.weights[class] = weight
+		}
+		p.credits = make(map[PriorityValue]int)
+	}
+}
+
+// WithReservation reserves n slots for goroutines with the given priority or higher.
+// Goroutines with a lower priority can only use the remaining shared slots, while goroutines
+// with the given priority or higher can use both the reserved and the shared slots. Their slots are
+// counted against the reservation first , so they only take shared slots once it is full.
+// Example: priority.NewLimiter(10, WithReservation(High, 2)) leaves 8 slots for the lower priorities.
+func WithReservation(priority PriorityValue, n int) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		if p.reservations == nil {
+			p.reservations = make(map[PriorityValue]int)
+		}
+		p.reservations[priority] = n
+	}
+}
+
+// WithPriorityCap limits the number of slots goroutines of the given priority can hold at once.
+// When a priority level is at its cap , Finish skips its waiters and admits the next eligible waiter.
+// The cap applies to the priority passed to Wait , dynamic priority does not move a goroutine to
+// another level. Release slots with FinishPriority , a permit or a ticket so that they are accounted
+// to the right level , Finish only guesses the level and avoids charging capped levels.
+// Example: priority.NewLimiter(10, WithPriorityCap(Low, 2)) never lets Low use more than 2 slots.
+func WithPriorityCap(priority PriorityValue, n int) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		if p.caps == nil {
+			p.caps = make(map[PriorityValue]int)
+		}
+		p.caps[priority] = n
+	}
+}
+
+// WithDeadlineScheduling orders waiters by their context deadline as specified by mode.
+// Waiters without a deadline are served after the waiters with one.
+// DeadlineFirst has no effect in weighted fair queueing mode , where deadlines only break ties
+// within a class.
+func WithDeadlineScheduling(mode DeadlineMode) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.deadlineMode = mode
+	}
+}
+
+// WithExpectedServiceTime configures how long the work guarded by the limiter is expected to take.
+// Goroutines whose context deadline is closer than the service time are rejected with
+// limiter.ErrDeadlineUnattainable , both when calling Wait and when they reach the front of the waitlist,
+// so capacity isn't wasted on work that will time out anyway.
+func WithExpectedServiceTime(serviceTime time.Duration) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.serviceTime = serviceTime
+	}
+}
+
+// WithBucketQueue stores the waitlist in a queue.BucketQueue instead of a binary heap.
+// Adding , admitting , removing and promoting waiters become O(1) , which pays off with many waiters.
+// Priorities must be within [0, queue.MaxBucketPriority]. Deadlines don't order waiters of the same
+// priority and a promoted waiter is placed behind the waiters already at its new priority.
+func WithBucketQueue() func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.queue = queue.NewBucketQueue()
+	}
+}
+
+// WithMaxWaiting limits the number of goroutines in the waitlist. When the waitlist is full a new
+// goroutine sheds the waiter which would be served last if that waiter has a lower priority ,
+// otherwise the new goroutine is rejected. Rejected and shed goroutines get a *limiter.AdmissionError
+// wrapping limiter.ErrRejected or limiter.ErrShed.
+func WithMaxWaiting(n int) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.maxWaiting = n
+	}
+}
+
+// WithBypassBudget limits how many goroutines bypassed by WaitOrBypass can be in flight at once.
+// When the budget is exhausted a timed out goroutine is not bypassed and gets limiter.ErrTimeout instead.
+// Bypassed goroutines must call FinishBypass when they are done , RunOrBypass does this for you.
+func WithBypassBudget(n int) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.bypassBudget = n
+	}
+}
+
+// WithAdmitWhilePaused keeps admitting goroutines with the given priority or higher while the
+// limiter is paused. The priority passed to Wait is used , dynamic priority does not make a
+// goroutine exempt.
+// Example: priority.NewLimiter(10, WithAdmitWhilePaused(High))
+func WithAdmitWhilePaused(priority PriorityValue) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.pauseExempt = priority
+	}
+}
+
+// WithLeaseDuration limits how long a slot acquired through Acquire or the Run methods can be held.
+// Expired leases are reclaimed so that a goroutine which panics or forgets to release does not shrink
+// the limiter forever. Releasing an expired permit is ignored.
+func WithLeaseDuration(duration time.Duration) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.leaseDuration = duration
+	}
+}
+
+// WithLeaseExpiredHook configures a function which is called when a lease expires.
+func WithLeaseExpiredHook(hook func(limiter.Lease)) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.onLeaseExpire = hook
+	}
+}
+
+// WithLeaseStacks records the stack of the acquirer in every lease. It is meant for debugging
+// as capturing the stack is expensive.
+func WithLeaseStacks() func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.leaseStacks = true
+	}
+}
+
+// WithClock replaces the real clock used for timeouts , dynamic priority , deadlines and leases.
+func WithClock(clock limiter.Clock) func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.clock = clock
+	}
+}
+
 // WithTimeout configures timeout in milliseconds.
 // Deprecated: use WithTimeoutDuration.
 func WithTimeout(timeout int) func(*PriorityLimiter) {
@@ -105,20 +342,105 @@ func WithTimeoutDuration(timeout time.Duration) func(*PriorityLimiter) {
 // High = 4
 func (p *PriorityLimiter) Wait(ctx context.Context, priority PriorityValue) error {
 	_, err := p.wait(ctx, priority, false)
+	if err == nil {
+		p.recordWait()
+	}
 	return err
 }
 
 // WaitOrBypass waits until capacity is available, or bypasses the limiter after the configured timeout.
+// Goroutines are only bypassed while the bypass budget is not exhausted. Call FinishBypass when the
+// bypassed work is done.
 func (p *PriorityLimiter) WaitOrBypass(ctx context.Context, priority PriorityValue) (limiter.AdmissionResult, error) {
-	return p.wait(ctx, priority, true)
+	result, err := p.wait(ctx, priority, true)
+	if result == limiter.AdmissionAcquired && err == nil {
+		p.recordWait()
+	}
+	return result, err
 }
 
 func (p *PriorityLimiter) wait(ctx context.Context, priority PriorityValue, allowBypass bool) (limiter.AdmissionResult, error) {
-	ok, w := p.proceed(priority)
+	start := p.clock.Now()
+	deadline, _ := ctx.Deadline()
+	if !deadline.IsZero() && p.unattainable(deadline) {
+		return 0, p.admissionError(limiter.AdmissionExpired, limiter.ErrDeadlineUnattainable, start, 0)
+	}
+	ok, w, position, err := p.enqueue(priority, deadline, nil)
 	if ok {
 		return limiter.AdmissionAcquired, nil
 	}
+	if err != nil {
+		return 0, p.admissionError(enqueueOutcome(err), err, start, position)
+	}
+	result, err := p.await(ctx, w, allowBypass)
+	if err != nil {
+		return 0, p.awaitError(err, start, position)
+	}
+	if outcome, ok := p.takeRemoved(w); ok {
+		return 0, p.admissionError(outcome, outcomeErrors[outcome], start, position)
+	}
+	return result, nil
+}
 
+// awaitError wraps an error returned by await.
+func (p *PriorityLimiter) awaitError(err error, start time.Time, position int) *limiter.AdmissionError {
+	outcome := limiter.AdmissionCanceled
+	if errors.Is(err, limiter.ErrTimeout) {
+		outcome = limiter.AdmissionTimedOut
+	}
+	return p.admissionError(outcome, err, start, position)
+}
+
+// outcomeErrors maps the reasons stored in PriorityLimiter.removed to their errors.
+var outcomeErrors = map[limiter.AdmissionResult]error{
+	limiter.AdmissionExpired: limiter.ErrDeadlineUnattainable,
+	limiter.AdmissionShed:    limiter.ErrShed,
+	limiter.AdmissionClosed:  limiter.ErrClosed,
+}
+
+// enqueueOutcome returns the outcome for an error returned by enqueue.
+func enqueueOutcome(err error) limiter.AdmissionResult {
+	if err == limiter.ErrClosed {
+		return limiter.AdmissionClosed
+	}
+	return limiter.AdmissionRejected
+}
+
+func (p *PriorityLimiter) admissionError(result limiter.AdmissionResult, err error, start time.Time, position int) *limiter.AdmissionError {
+	return &limiter.AdmissionError{
+		Result:   result,
+		Waited:   p.clock.Now().Sub(start),
+		Position: position,
+		Err:      err,
+	}
+}
+
+// unattainable reports whether the work can't complete before the deadline.
+func (p *PriorityLimiter) unattainable(deadline time.Time) bool {
+	return p.serviceTime > 0 && deadline.Sub(p.clock.Now()) < p.serviceTime
+}
+
+// takeRemoved returns why another goroutine removed the waiter from the waitlist.
+func (p *PriorityLimiter) takeRemoved(w *queue.Item) (limiter.AdmissionResult, bool) {
+	p.mu.Lock()
+	defer p.unlock()
+	outcome, ok := p.removed[w]
+	delete(p.removed, w)
+	return outcome, ok
+}
+
+// evict removes the waiter from the waitlist on behalf of another goroutine and records why.
+// Callers must hold p.mu.
+func (p *PriorityLimiter) evict(w *queue.Item, outcome limiter.AdmissionResult) {
+	p.queue.Remove(w)
+	delete(p.classes, w)
+	delete(p.deadlines, w)
+	p.removed[w] = outcome
+	p.signal(w)
+}
+
+// await blocks until the queued waiter is admitted or removed by the context or timeout.
+func (p *PriorityLimiter) await(ctx context.Context, w *queue.Item, allowBypass bool) (limiter.AdmissionResult, error) {
 	if p.dynamicPeriod == nil && p.timeout == nil {
 		select {
 		case <-w.Done:
@@ -143,8 +465,8 @@ func (p *PriorityLimiter) wait(ctx context.Context, priority PriorityValue, allo
 }
 
 func (p *PriorityLimiter) dynamicPriorityAndTimeout(ctx context.Context, w *queue.Item, allowBypass bool) (limiter.AdmissionResult, error) {
-	ticker := time.NewTicker(*p.dynamicPeriod)
-	timer := time.NewTimer(*p.timeout)
+	ticker := p.clock.NewTicker(*p.dynamicPeriod)
+	timer := p.clock.NewTimer(*p.timeout)
 	defer ticker.Stop()
 	defer timer.Stop()
 	for {
@@ -156,15 +478,15 @@ func (p *PriorityLimiter) dynamicPriorityAndTimeout(ctx context.Context, w *queu
 				return 0, ctx.Err()
 			}
 			return limiter.AdmissionAcquired, nil
-		case <-timer.C:
+		case <-timer.C():
 			if p.removeWaiter(w) {
-				if allowBypass {
+				if allowBypass && p.bypass() {
 					return limiter.AdmissionBypassed, nil
 				}
 				return 0, limiter.ErrTimeout
 			}
 			return limiter.AdmissionAcquired, nil
-		case <-ticker.C:
+		case <-ticker.C():
 			// edge case where we receive ctx.Done and ticker.C at the same time...
 			select {
 			case <-ctx.Done():
@@ -176,36 +498,38 @@ func (p *PriorityLimiter) dynamicPriorityAndTimeout(ctx context.Context, w *queu
 			}
 			p.mu.Lock()
 			if w.Priority < int(High) {
-				if _, ok := p.waitList.FindIndex(w); !ok {
-					p.mu.Unlock()
+				if !p.queue.Contains(w) {
+					p.unlock()
 					return limiter.AdmissionAcquired, nil
 				}
 				currentPriority := w.Priority
-				p.waitList.Update(w, currentPriority+1)
+				p.queue.Update(w, currentPriority+1)
+				p.dispatch()
 			}
-			p.mu.Unlock()
+			p.unlock()
 		}
 	}
 }
 
 func (p *PriorityLimiter) handleDynamicPriority(ctx context.Context, w *queue.Item) (limiter.AdmissionResult, error) {
-	ticker := time.NewTicker(*p.dynamicPeriod)
+	ticker := p.clock.NewTicker(*p.dynamicPeriod)
 	defer ticker.Stop()
 	for {
 		select {
 		case <-w.Done:
 			return limiter.AdmissionAcquired, nil
-		case <-ticker.C:
+		case <-ticker.C():
 			p.mu.Lock()
 			if w.Priority < int(High) {
-				if _, ok := p.waitList.FindIndex(w); !ok {
-					p.mu.Unlock()
+				if !p.queue.Contains(w) {
+					p.unlock()
 					return limiter.AdmissionAcquired, nil
 				}
 				currentPriority := w.Priority
-				p.waitList.Update(w, currentPriority+1)
+				p.queue.Update(w, currentPriority+1)
+				p.dispatch()
 			}
-			p.mu.Unlock()
+			p.unlock()
 		case <-ctx.Done():
 			if p.removeWaiter(w) {
 				return 0, ctx.Err()
@@ -216,14 +540,14 @@ func (p *PriorityLimiter) handleDynamicPriority(ctx context.Context, w *queue.It
 }
 
 func (p *PriorityLimiter) handleTimeout(ctx context.Context, w *queue.Item, allowBypass bool) (limiter.AdmissionResult, error) {
-	timer := time.NewTimer(*p.timeout)
+	timer := p.clock.NewTimer(*p.timeout)
 	defer timer.Stop()
 	select {
 	case <-w.Done:
 		return limiter.AdmissionAcquired, nil
-	case <-timer.C:
+	case <-timer.C():
 		if p.removeWaiter(w) {
-			if allowBypass {
+			if allowBypass && p.bypass() {
 				return limiter.AdmissionBypassed, nil
 			}
 			return 0, limiter.ErrTimeout
@@ -237,11 +561,38 @@ func (p *PriorityLimiter) handleTimeout(ctx context.Context, w *queue.Item, allo
 	}
 }
 
+// bypass reserves a place in the bypass budget.
+func (p *PriorityLimiter) bypass() bool {
+	p.mu.Lock()
+	defer p.unlock()
+	if p.bypassBudget > 0 && p.bypassing >= p.bypassBudget {
+		return false
+	}
+	p.bypassing++
+	return true
+}
+
+// FinishBypass reports that a goroutine bypassed by WaitOrBypass is done.
+func (p *PriorityLimiter) FinishBypass() {
+	p.mu.Lock()
+	defer p.unlock()
+	if p.bypassing > 0 {
+		p.bypassing--
+	}
+}
+
 func (p *PriorityLimiter) removeWaiter(w *queue.Item) bool {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	if idx, ok := p.waitList.FindIndex(w); ok {
-		heap.Remove(&p.waitList, idx)
+	defer p.unlock()
+	return p.removeWaiterLocked(w)
+}
+
+// removeWaiterLocked removes the waiter from the waitlist if it is still queued. Callers must hold p.mu.
+func (p *PriorityLimiter) removeWaiterLocked(w *queue.Item) bool {
+	if p.queue.Remove(w) {
+		delete(p.classes, w)
+		delete(p.deadlines, w)
+		delete(p.async, w)
 		close(w.Done)
 		return true
 	}
@@ -252,48 +603,433 @@ func (p *PriorityLimiter) removeWaiter(w *queue.Item) bool {
 // will add the goroutine to the priority queue and will return a channel. This channel is used by goutines to
 // check for signal when they are granted access to use the resource.
 func (p *PriorityLimiter) proceed(priority PriorityValue) (bool, *queue.Item) {
+	return p.proceedDeadline(priority, time.Time{})
+}
+
+// proceedDeadline is like proceed but queues the waiter with the given context deadline.
+func (p *PriorityLimiter) proceedDeadline(priority PriorityValue, deadline time.Time) (bool, *queue.Item) {
+	ok, w, _, _ := p.enqueue(priority, deadline, nil)
+	return ok, w
+}
+
+// enqueue is like proceedDeadline but also returns the number of goroutines already waiting.
+// An error is returned when the limiter is closed or the waitlist is full. async is registered
+// for a caller of AcquireAsync before the waiter is visible to other goroutines.
+func (p *PriorityLimiter) enqueue(priority PriorityValue, deadline time.Time, async *asyncWait) (bool, *queue.Item, int, error) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
+	defer p.unlock()
 
-	if p.count < p.limit {
+	if p.closed {
+		return false, nil, 0, limiter.ErrClosed
+	}
+	if p.free(priority) && !p.capped(priority) && !p.pausedFor(priority) {
 		p.count++
-		return true, nil
+		p.inUse[priority]++
+		return true, nil, 0, nil
+	}
+	position := p.queue.Len()
+	if p.maxWaiting > 0 && position >= p.maxWaiting {
+		victim := p.last()
+		if victim == nil || victim.Priority >= int(priority) {
+			return false, nil, position, limiter.ErrRejected
+		}
+		p.evict(victim, limiter.AdmissionShed)
+		position--
 	}
 	ch := make(chan struct{})
 	w := &queue.Item{
 		Priority: int(priority),
 		Done:     ch,
 	}
-	heap.Push(&p.waitList, w)
-	return false, w
+	if p.deadlineMode != 0 {
+		w.Deadline = deadline
+	}
+	p.queue.Push(w)
+	p.classes[w] = priority
+	if !deadline.IsZero() {
+		p.deadlines[w] = deadline
+	}
+	if async != nil {
+		async.position = position
+		p.async[w] = async
+	}
+	// preempting a holder only helps when the waiter is blocked by the number of slots in use.
+	if p.preemption && !p.free(priority) && !p.capped(priority) && !p.pausedFor(priority) {
+		p.preempt(priority)
+	}
+	return false, w, position, nil
+}
+
+// last returns the waiter which would be served last or nil if the waitlist is empty.
+func (p *PriorityLimiter) last() *queue.Item {
+	var worst *queue.Item
+	p.queue.Each(func(it *queue.Item) {
+		if worst == nil || p.queue.Less(worst, it) {
+			worst = it
+		}
+	})
+	return worst
 }
 
 // Finish will remove the goroutine from the priority queue and sends a signal
-// to the waiting goroutine to access the resource
+// to the waiting goroutine to access the resource.
+// Finish does not know which priority level released the slot , so the accounting is approximate:
+// the slot is charged to the lowest level currently holding one , skipping the levels with a cap
+// configured by WithPriorityCap unless only capped levels hold slots. Charging a capped level for
+// a slot it still holds would let it exceed its cap , use FinishPriority for exact accounting.
 func (p *PriorityLimiter) Finish() {
 	p.mu.Lock()
-	defer p.mu.Unlock()
+	defer p.unlock()
+	p.forgetWait()
 	if p.count == 0 {
 		return
 	}
-	p.count -= 1
-	if p.waitList.Len() == 0 {
+	var lowest PriorityValue
+	found, foundCapped := false, false
+	for level, n := range p.inUse {
+		if n == 0 {
+			continue
+		}
+		_, capped := p.caps[level]
+		if !found || (foundCapped && !capped) || (foundCapped == capped && level < lowest) {
+			lowest, found, foundCapped = level, true, capped
+		}
+	}
+	p.release(lowest)
+}
+
+// FinishPriority releases a slot acquired with the given priority and hands it to the next
+// eligible waiter.
+func (p *PriorityLimiter) FinishPriority(priority PriorityValue) {
+	p.mu.Lock()
+	defer p.unlock()
+	p.forgetWait()
+	if p.count == 0 {
+		return
+	}
+	p.release(priority)
+}
+
+// finish releases a slot of a permit or a ticket , whose acquisition is forgotten by the caller.
+func (p *PriorityLimiter) finish(priority PriorityValue) {
+	p.mu.Lock()
+	defer p.unlock()
+	if p.count == 0 {
 		return
 	}
-	ele := heap.Pop(&p.waitList)
-	it := ele.(*queue.Item)
-	p.count++
-	close(it.Done)
+	p.release(priority)
+}
+
+// release frees one slot of the given priority level. Callers must hold p.mu.
+func (p *PriorityLimiter) release(priority PriorityValue) {
+	p.count -= 1
+	if p.inUse[priority] > 0 {
+		p.inUse[priority]--
+	}
+	if p.closed && p.count == 0 && p.idle != nil {
+		close(p.idle)
+		p.idle = nil
+	}
+	p.dispatch()
+}
+
+// Pause stops admitting goroutines , except the ones exempted by WithAdmitWhilePaused.
+// New goroutines are added to the waitlist and the waiting goroutines keep waiting , subject to
+// their timeouts and contexts , until Resume is called.
+func (p *PriorityLimiter) Pause() {
+	p.mu.Lock()
+	defer p.unlock()
+	p.paused = true
+}
+
+// Resume admits goroutines again , starting with the waitlist in priority order.
+func (p *PriorityLimiter) Resume() {
+	p.mu.Lock()
+	defer p.unlock()
+	p.paused = false
+	p.dispatch()
+}
+
+// Paused reports whether admission is paused.
+func (p *PriorityLimiter) Paused() bool {
+	p.mu.Lock()
+	defer p.unlock()
+	return p.paused
+}
+
+// Close fails all current and future waiters with limiter.ErrClosed. Goroutines which already
+// acquired a slot are not affected and should still call Finish.
+func (p *PriorityLimiter) Close() {
+	p.mu.Lock()
+	defer p.unlock()
+	p.closeLocked()
+}
+
+func (p *PriorityLimiter) closeLocked() {
+	p.closed = true
+	for w := p.queue.Front(); w != nil; w = p.queue.Front() {
+		p.evict(w, limiter.AdmissionClosed)
+	}
+}
+
+// Drain stops admitting new work like Close and blocks until every goroutine which acquired
+// a slot called Finish or the context is done , in which case the context error is returned.
+func (p *PriorityLimiter) Drain(ctx context.Context) error {
+	p.mu.Lock()
+	p.closeLocked()
+	if p.count == 0 {
+		p.unlock()
+		return nil
+	}
+	if p.idle == nil {
+		p.idle = make(chan struct{})
+	}
+	idle := p.idle
+	p.unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// dispatch hands free capacity to the waiters selected by next. Callers must hold p.mu.
+func (p *PriorityLimiter) dispatch() {
+	for p.count < p.limit {
+		it := p.next()
+		if it == nil {
+			return
+		}
+		if deadline, ok := p.deadlines[it]; ok && p.unattainable(deadline) {
+			p.evict(it, limiter.AdmissionExpired)
+			continue
+		}
+		p.queue.Remove(it)
+		p.count++
+		p.inUse[p.classes[it]]++
+		delete(p.classes, it)
+		delete(p.deadlines, it)
+		p.signal(it)
+	}
+}
+
+// next returns the waiter which should be admitted next or nil if there is none.
+func (p *PriorityLimiter) next() *queue.Item {
+	front := p.queue.Front()
+	if front == nil {
+		return nil
+	}
+	if p.weights != nil {
+		return p.nextWeighted()
+	}
+	if p.deadlineMode == DeadlineFirst {
+		return p.nextDeadline()
+	}
+	if p.eligible(front) {
+		return front
+	}
+	// the front of the waitlist has the highest priority, if it can not use the free
+	// capacity then only a cap , a pause exemption or a reservation for the class of an aged
+	// waiter can make another waiter eligible.
+	if p.caps == nil && !p.paused && p.reservations == nil {
+		return nil
+	}
+	var best *queue.Item
+	p.queue.Each(func(it *queue.Item) {
+		if p.eligible(it) && (best == nil || p.queue.Less(it, best)) {
+			best = it
+		}
+	})
+	return best
+}
+
+// nextDeadline returns the eligible waiter with the earliest deadline.
+func (p *PriorityLimiter) nextDeadline() *queue.Item {
+	var best *queue.Item
+	p.queue.Each(func(it *queue.Item) {
+		if !p.eligible(it) {
+			return
+		}
+		if best == nil {
+			best = it
+			return
+		}
+		if !it.Deadline.Equal(best.Deadline) {
+			if queue.EarlierDeadline(it.Deadline, best.Deadline) {
+				best = it
+			}
+			return
+		}
+		if p.queue.Less(it, best) {
+			best = it
+		}
+	})
+	return best
+}
+
+// eligible reports whether the waiter can be admitted with the current usage.
+func (p *PriorityLimiter) eligible(it *queue.Item) bool {
+	class := p.classes[it]
+	return p.free(class) && !p.capped(class) && !p.pausedFor(class)
+}
+
+// pausedFor reports whether admission is paused for the given priority.
+func (p *PriorityLimiter) pausedFor(priority PriorityValue) bool {
+	return p.paused && (p.pauseExempt == 0 || priority < p.pauseExempt)
+}
+
+// capped reports whether the priority level already holds as many slots as its cap allows.
+func (p *PriorityLimiter) capped(priority PriorityValue) bool {
+	n, ok := p.caps[priority]
+	return ok && p.inUse[priority] >= n
+}
+
+// capacity returns the number of slots usable by goroutines of the given priority.
+// Slots reserved for higher priorities are excluded.
+func (p *PriorityLimiter) capacity(priority PriorityValue) int {
+	c := p.limit
+	for level, n := range p.reservations {
+		if level > priority {
+			c -= n
+		}
+	}
+	return c
+}
+
+// free reports whether a slot is free for goroutines of the given priority. The slots held by
+// higher priorities are counted against their reservations first , only the usage beyond the
+// reservations takes the slots shared with the given priority. Callers must hold p.mu.
+func (p *PriorityLimiter) free(priority PriorityValue) bool {
+	return p.count-p.reservedInUse(priority) < p.capacity(priority)
+}
+
+// reservedInUse returns the number of slots held within the reservations of the levels above the
+// given priority. A reservation is filled by the goroutines of its level or higher which are not
+// already counted against the reservation of a higher level. Callers must hold p.mu.
+func (p *PriorityLimiter) reservedInUse(priority PriorityValue) int {
+	used := 0
+	for _, level := range p.reservedLevels {
+		if level <= priority {
+			break
+		}
+		used = min(used+p.reservations[level], p.inUseFrom(level))
+	}
+	return used
+}
+
+// inUseFrom returns the number of slots held by the given priority level or higher.
+// Callers must hold p.mu.
+func (p *PriorityLimiter) inUseFrom(priority PriorityValue) int {
+	n := 0
+	for level, used := range p.inUse {
+		if level >= priority {
+			n += used
+		}
+	}
+	return n
+}
+
+// reserved returns the total number of reserved slots.
+func (p *PriorityLimiter) reserved() int {
+	total := 0
+	for _, n := range p.reservations {
+		total += n
+	}
+	return total
+}
+
+// nextWeighted picks a priority class using smooth weighted round robin over the classes
+// which currently have waiters and returns the oldest waiter of that class.
+func (p *PriorityLimiter) nextWeighted() *queue.Item {
+	heads := make(map[PriorityValue]*queue.Item)
+	p.queue.Each(func(it *queue.Item) {
+		if !p.eligible(it) {
+			return
+		}
+		// waiters are grouped by the priority they asked for , aging does not move them into
+		// the share of a higher class.
+		class := p.classes[it]
+		if head, ok := heads[class]; !ok || p.queue.Less(it, head) {
+			heads[class] = it
+		}
+	})
+
+	total := 0
+	for class := range heads {
+		if w := p.weights[class]; w > 0 {
+			total += w
+		}
+	}
+	if len(heads) == 0 {
+		return nil
+	}
+	// no waiting class has a weight, fall back to strict priority.
+	if total == 0 {
+		var best *queue.Item
+		for _, it := range heads {
+			if best == nil || p.queue.Less(it, best) {
+				best = it
+			}
+		}
+		return best
+	}
+
+	for class := range p.credits {
+		if _, ok := heads[class]; !ok {
+			delete(p.credits, class)
+		}
+	}
+	picked, found := PriorityValue(0), false
+	for class := range heads {
+		w := p.weights[class]
+		if w <= 0 {
+			continue
+		}
+		p.credits[class] += w
+		if !found || p.credits[class] > p.credits[picked] ||
+			(p.credits[class] == p.credits[picked] && class > picked) {
+			picked, found = class, true
+		}
+	}
+	p.credits[picked] -= total
+	return heads[picked]
+}
+
+// Acquire is like Wait but returns a permit which releases the slot.
+// The permit is a lease when WithLeaseDuration is configured.
+func (p *PriorityLimiter) Acquire(ctx context.Context, priority PriorityValue) (*limiter.Permit, error) {
+	if _, err := p.wait(ctx, priority, false); err != nil {
+		return nil, err
+	}
+	return p.permit(priority, p.acquisition()), nil
+}
+
+// permit wraps a slot acquired with the given priority in a permit. a is recorded until the
+// permit is released when tracking is enabled.
+func (p *PriorityLimiter) permit(priority PriorityValue, a limiter.Acquisition) *limiter.Permit {
+	var stack []byte
+	if p.leaseStacks {
+		stack = debug.Stack()
+	}
+	e := p.record(a)
+	return limiter.NewPermit(p.clock, func() {
+		p.forget(e)
+		p.finish(priority)
+	}, p.leaseDuration, stack, p.onLeaseExpire)
 }
 
 // Run wraps the function to limit the concurrency.....
+// The slot is released even if the callback panics.
 func (p *PriorityLimiter) Run(ctx context.Context,
 	priority PriorityValue,
 	callback func() error) error {
-	if err := p.Wait(ctx, priority); err != nil {
+	permit, err := p.Acquire(ctx, priority)
+	if err != nil {
 		return err
 	}
-	defer p.Finish()
+	defer permit.Release()
 	return callback()
 }
 
@@ -302,27 +1038,77 @@ func (p *PriorityLimiter) Run(ctx context.Context,
 func (p *PriorityLimiter) RunOrBypass(ctx context.Context,
 	priority PriorityValue,
 	callback func() error) (limiter.AdmissionResult, error) {
-	result, err := p.WaitOrBypass(ctx, priority)
+	result, err := p.wait(ctx, priority, true)
 	if err != nil {
 		return 0, err
 	}
 	if result == limiter.AdmissionAcquired {
-		defer p.Finish()
+		defer p.permit(priority, p.acquisition()).Release()
+	} else {
+		defer p.FinishBypass()
 	}
 	return result, callback()
 }
 
+// RunWithFallback executes primary when capacity was actually acquired. When the goroutine is not
+// admitted because the timeout expired , the waitlist is full , it was shed or the deadline is
+// unattainable , fallback is executed instead with the reason. The fallback doesn't use the guarded
+// resource , so it takes no bypass budget and is not counted by Stats().Bypassed.
+// If the context is done or the limiter is closed before admission neither function is executed
+// and the error is returned.
+func (p *PriorityLimiter) RunWithFallback(ctx context.Context,
+	priority PriorityValue,
+	primary func() error,
+	fallback func(ctx context.Context, result limiter.AdmissionResult) error) error {
+	if _, err := p.wait(ctx, priority, false); err != nil {
+		switch outcome := limiter.Outcome(err); outcome {
+		case 0, limiter.AdmissionCanceled, limiter.AdmissionClosed:
+			return err
+		default:
+			return fallback(ctx, outcome)
+		}
+	}
+	defer p.permit(priority, p.acquisition()).Release()
+	return primary()
+}
+
 // only used in tests
 func (p *PriorityLimiter) waitListSize() int {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	len := p.waitList.Len()
+	defer p.unlock()
+	len := p.queue.Len()
 	return len
 }
 
 // Count returns the current number of concurrent gouroutines executing...
 func (p *PriorityLimiter) Count() int {
 	p.mu.Lock()
-	defer p.mu.Unlock()
+	defer p.unlock()
 	return p.count
 }
+
+// Stats returns a snapshot of the limiter usage.
+// Shared slots are used first, so reserved slots are only counted as in use once the shared
+// slots are exhausted.
+func (p *PriorityLimiter) Stats() Stats {
+	p.mu.Lock()
+	defer p.unlock()
+	reservedInUse := p.reservedInUse(PriorityValue(math.MinInt))
+	st := Stats{
+		Limit:         p.limit,
+		InUse:         p.count,
+		Waiting:       p.queue.Len(),
+		Reserved:      p.reserved(),
+		ReservedInUse: reservedInUse,
+		SharedInUse:   p.count - reservedInUse,
+		Bypassed:      p.bypassing,
+
+		InUseByPriority: make(map[PriorityValue]int, len(p.inUse)),
+	}
+	for level, n := range p.inUse {
+		if n > 0 {
+			st.InUseByPriority[level] = n
+		}
+	}
+	return st
+}
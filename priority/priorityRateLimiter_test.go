@@ -1,9 +1,10 @@
 package priority
 
 import (
-	"container/heap"
 	"context"
 	"errors"
+	"fmt"
+	"runtime"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/limitertest"
 	"github.com/vivek-ng/concurrency-limiter/queue"
 )
 
@@ -140,7 +142,7 @@ func TestDynamicPriorityPromotesLowPriorityWaiters(t *testing.T) {
 	time.Sleep(120 * time.Millisecond)
 	assert.Equal(t, 2, nl.waitListSize())
 
-	top := nl.waitList.Top().(queue.Item)
+	top := nl.queue.Front()
 	assert.GreaterOrEqual(t, top.Priority, int(High))
 
 	nl.Finish()
@@ -363,11 +365,767 @@ func TestPriorityQueueOrderingStillMatchesLimiterExpectations(t *testing.T) {
 	_, _ = nl.proceed(High)
 	_, _ = nl.proceed(Medium)
 
-	first := heap.Pop(&nl.waitList).(*queue.Item)
-	second := heap.Pop(&nl.waitList).(*queue.Item)
-	third := heap.Pop(&nl.waitList).(*queue.Item)
+	pop := func() *queue.Item {
+		front := nl.queue.Front()
+		nl.queue.Remove(front)
+		return front
+	}
+	first := pop()
+	second := pop()
+	third := pop()
 
 	assert.Equal(t, int(High), first.Priority)
 	assert.Equal(t, int(Medium), second.Priority)
 	assert.Equal(t, int(Low), third.Priority)
 }
+
+func TestWeightedFairQueueingLongRunShare(t *testing.T) {
+	nl := NewLimiter(1, WithWeightedFairQueueing(map[PriorityValue]int{
+		High:   60,
+		Medium: 30,
+		Low:    10,
+	}))
+	ok, _ := nl.proceed(Low)
+	assert.True(t, ok)
+
+	waiters := make(map[*queue.Item]PriorityValue)
+	for _, class := range []PriorityValue{High, Medium, Low} {
+		for i := 0; i < 1000; i++ {
+			_, w := nl.proceed(class)
+			waiters[w] = class
+		}
+	}
+
+	released := make(map[PriorityValue]int)
+	for i := 0; i < 1000; i++ {
+		nl.Finish()
+		for w, class := range waiters {
+			select {
+			case <-w.Done:
+				released[class]++
+				delete(waiters, w)
+			default:
+			}
+		}
+	}
+
+	assert.Equal(t, 600, released[High])
+	assert.Equal(t, 300, released[Medium])
+	assert.Equal(t, 100, released[Low])
+	assert.Equal(t, 1, nl.Count())
+}
+
+func TestWeightedFairQueueingRedistributesUnusedShare(t *testing.T) {
+	nl := NewLimiter(1, WithWeightedFairQueueing(map[PriorityValue]int{
+		High:   60,
+		Medium: 30,
+		Low:    10,
+	}))
+	ok, _ := nl.proceed(Low)
+	assert.True(t, ok)
+
+	var high, low []*queue.Item
+	for i := 0; i < 100; i++ {
+		_, w := nl.proceed(High)
+		high = append(high, w)
+		_, w = nl.proceed(Low)
+		low = append(low, w)
+	}
+
+	for i := 0; i < 70; i++ {
+		nl.Finish()
+	}
+
+	countDone := func(items []*queue.Item) int {
+		n := 0
+		for _, w := range items {
+			select {
+			case <-w.Done:
+				n++
+			default:
+			}
+		}
+		return n
+	}
+	assert.Equal(t, 60, countDone(high))
+	assert.Equal(t, 10, countDone(low))
+}
+
+func TestWeightedFairQueueingSharesIgnoreAging(t *testing.T) {
+	clock := limitertest.NewFakeClock(time.Now())
+	nl := NewLimiter(1,
+		WithWeightedFairQueueing(map[PriorityValue]int{High: 3, Low: 1}),
+		WithDynamicPriorityDuration(5*time.Millisecond),
+		WithClock(clock),
+		WithExecutor(limiter.Inline),
+	)
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, High))
+
+	var admitted []PriorityValue
+	acquire := func(class PriorityValue) {
+		nl.AcquireAsync(ctx, class, func(p *limiter.Permit, err error) {
+			assert.NoError(t, err)
+			admitted = append(admitted, class)
+			p.Release()
+		})
+	}
+	for i := 0; i < 4; i++ {
+		acquire(Low)
+	}
+	// the low priority waiters age up to High before the high priority waiters arrive.
+	clock.Advance(15 * time.Millisecond)
+	for i := 0; i < 4; i++ {
+		acquire(High)
+	}
+
+	nl.FinishPriority(High)
+	if assert.Len(t, admitted, 8) {
+		assert.Equal(t, []PriorityValue{High, High, Low, High}, admitted[:4])
+	}
+}
+
+func TestReservationKeepsSlotsForHighPriority(t *testing.T) {
+	nl := NewLimiter(3, WithReservation(High, 1))
+	for i := 0; i < 2; i++ {
+		ok, _ := nl.proceed(Low)
+		assert.True(t, ok)
+	}
+
+	ok, low := nl.proceed(Low)
+	assert.False(t, ok)
+	ok, _ = nl.proceed(High)
+	assert.True(t, ok)
+
+	st := nl.Stats()
+	assert.Equal(t, 3, st.InUse)
+	assert.Equal(t, 1, st.Waiting)
+	assert.Equal(t, 1, st.Reserved)
+	assert.Equal(t, 1, st.ReservedInUse)
+	assert.Equal(t, 2, st.SharedInUse)
+
+	// releasing the reserved slot does not admit the low priority waiter.
+	nl.FinishPriority(High)
+	select {
+	case <-low.Done:
+		t.Fatal("did not expect low priority waiter to use the reserved slot")
+	default:
+	}
+
+	nl.FinishPriority(Low)
+	select {
+	case <-low.Done:
+	default:
+		t.Fatal("expected low priority waiter to use the shared slot")
+	}
+	assert.Equal(t, 2, nl.Count())
+}
+
+func TestReservationCountsHighPriorityUsageFirst(t *testing.T) {
+	nl := NewLimiter(10, WithReservation(High, 2))
+	for i := 0; i < 8; i++ {
+		ok, _ := nl.proceed(High)
+		assert.True(t, ok)
+	}
+
+	// 2 of the High slots are the reserved ones , so High only holds 6 of the 8 shared slots.
+	for i := 0; i < 2; i++ {
+		ok, _ := nl.proceed(Low)
+		assert.True(t, ok)
+	}
+	ok, low := nl.proceed(Low)
+	assert.False(t, ok)
+	st := nl.Stats()
+	assert.Equal(t, 2, st.Reserved)
+	assert.Equal(t, 2, st.ReservedInUse)
+	assert.Equal(t, 8, st.SharedInUse)
+
+	nl.FinishPriority(High)
+	<-low.Done
+	st = nl.Stats()
+	assert.Equal(t, 2, st.ReservedInUse)
+	assert.Equal(t, 8, st.SharedInUse)
+}
+
+func TestReservationNotUsedByAgedWaiter(t *testing.T) {
+	clock := limitertest.NewFakeClock(time.Now())
+	nl := NewLimiter(3,
+		WithReservation(High, 1),
+		WithDynamicPriorityDuration(5*time.Millisecond),
+		WithClock(clock),
+		WithExecutor(limiter.Inline),
+	)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, nl.Wait(ctx, Low))
+	}
+
+	var permit *limiter.Permit
+	nl.AcquireAsync(ctx, Low, func(p *limiter.Permit, err error) {
+		assert.NoError(t, err)
+		permit = p
+	})
+	clock.Advance(15 * time.Millisecond)
+	// the waiter aged up to High but it still asked for Low , the reserved slot stays free.
+	assert.Equal(t, int(High), nl.queue.Front().Priority)
+	assert.Nil(t, permit)
+	assert.Equal(t, map[PriorityValue]int{Low: 2}, nl.Stats().InUseByPriority)
+
+	assert.NoError(t, nl.Wait(ctx, High))
+	assert.Equal(t, 1, nl.Stats().ReservedInUse)
+
+	nl.FinishPriority(High)
+	assert.Nil(t, permit)
+	nl.FinishPriority(Low)
+	if assert.NotNil(t, permit) {
+		permit.Release()
+	}
+	nl.FinishPriority(Low)
+	assert.Zero(t, nl.Count())
+}
+
+func TestPriorityCapFinishSkipsCappedLevels(t *testing.T) {
+	nl := NewLimiter(4, WithPriorityCap(Low, 2))
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, Low))
+	assert.NoError(t, nl.Wait(ctx, Low))
+	assert.NoError(t, nl.Wait(ctx, High))
+
+	// Charging the lowest level would let a third Low in , Finish charges High instead.
+	nl.Finish()
+	assert.Equal(t, 2, nl.Count())
+	ok, low := nl.proceed(Low)
+	assert.False(t, ok)
+	assert.Equal(t, map[PriorityValue]int{Low: 2}, nl.Stats().InUseByPriority)
+
+	nl.FinishPriority(Low)
+	<-low.Done
+	assert.Equal(t, map[PriorityValue]int{Low: 2}, nl.Stats().InUseByPriority)
+}
+
+func TestPriorityCapSkipsCappedWaiters(t *testing.T) {
+	nl := NewLimiter(3, WithPriorityCap(Low, 1))
+	ok, _ := nl.proceed(Low)
+	assert.True(t, ok)
+	ok, low := nl.proceed(Low)
+	assert.False(t, ok)
+	ok, _ = nl.proceed(High)
+	assert.True(t, ok)
+	ok, _ = nl.proceed(Medium)
+	assert.True(t, ok)
+
+	ok, medium := nl.proceed(Medium)
+	assert.False(t, ok)
+
+	// the high priority slot is handed to the medium waiter because Low is at its cap.
+	nl.FinishPriority(High)
+	select {
+	case <-medium.Done:
+	default:
+		t.Fatal("expected medium priority waiter to be admitted")
+	}
+	select {
+	case <-low.Done:
+		t.Fatal("did not expect low priority waiter to exceed its cap")
+	default:
+	}
+	assert.Equal(t, map[PriorityValue]int{Low: 1, Medium: 2}, nl.Stats().InUseByPriority)
+
+	nl.FinishPriority(Low)
+	select {
+	case <-low.Done:
+	default:
+		t.Fatal("expected low priority waiter to be admitted")
+	}
+	assert.Equal(t, 3, nl.Count())
+}
+
+func TestPriorityCapKeepsFIFOWithinClass(t *testing.T) {
+	nl := NewLimiter(2, WithPriorityCap(Low, 1))
+	assert.NoError(t, nl.Wait(context.Background(), Low))
+	assert.NoError(t, nl.Wait(context.Background(), High))
+
+	order := make(chan int, 2)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			assert.NoError(t, nl.Run(context.Background(), Low, func() error {
+				order <- index
+				return nil
+			}))
+		}(i)
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	nl.FinishPriority(High)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 1, nl.Count())
+	nl.FinishPriority(Low)
+
+	wg.Wait()
+	close(order)
+	var got []int
+	for index := range order {
+		got = append(got, index)
+	}
+	assert.Equal(t, []int{0, 1}, got)
+	assert.Zero(t, nl.Count())
+}
+
+func TestDeadlineTieBreakOrdersSamePriority(t *testing.T) {
+	nl := NewLimiter(1, WithDeadlineScheduling(DeadlineTieBreak))
+	ok, _ := nl.proceed(Low)
+	assert.True(t, ok)
+
+	now := time.Now()
+	_, late := nl.proceedDeadline(Low, now.Add(5*time.Second))
+	_, soon := nl.proceedDeadline(Low, now.Add(5*time.Millisecond))
+	_, high := nl.proceedDeadline(High, now.Add(time.Hour))
+
+	for _, w := range []*queue.Item{high, soon, late} {
+		nl.Finish()
+		select {
+		case <-w.Done:
+		default:
+			t.Fatal("waiters were not released in priority then deadline order")
+		}
+	}
+}
+
+func TestDeadlineFirstIgnoresPriority(t *testing.T) {
+	nl := NewLimiter(1, WithDeadlineScheduling(DeadlineFirst))
+	ok, _ := nl.proceed(Low)
+	assert.True(t, ok)
+
+	now := time.Now()
+	_, none := nl.proceedDeadline(High, time.Time{})
+	_, late := nl.proceedDeadline(High, now.Add(5*time.Second))
+	_, soon := nl.proceedDeadline(Low, now.Add(5*time.Millisecond))
+
+	for _, w := range []*queue.Item{soon, late, none} {
+		nl.Finish()
+		select {
+		case <-w.Done:
+		default:
+			t.Fatal("waiters were not released in deadline order")
+		}
+	}
+}
+
+func TestExpectedServiceTimeRejectsUnattainableDeadline(t *testing.T) {
+	nl := NewLimiter(1, WithExpectedServiceTime(50*time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.True(t, errors.Is(nl.Wait(ctx, High), limiter.ErrDeadlineUnattainable))
+	assert.Zero(t, nl.Count())
+	assert.Zero(t, nl.waitListSize())
+}
+
+func TestExpectedServiceTimeRejectsWaiterAtDispatch(t *testing.T) {
+	nl := NewLimiter(1, WithExpectedServiceTime(50*time.Millisecond), WithDeadlineScheduling(DeadlineTieBreak))
+	assert.NoError(t, nl.Wait(context.Background(), High))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 80*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- nl.Wait(ctx, Low)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	nl.Finish()
+
+	assert.True(t, errors.Is(<-done, limiter.ErrDeadlineUnattainable))
+	assert.Zero(t, nl.Count())
+	assert.Zero(t, nl.waitListSize())
+}
+
+func TestExpectedServiceTimeRejectsWaiterAtDispatchWithoutDeadlineMode(t *testing.T) {
+	// the fake clock is ahead of the real one , so the context is not done before the deadline.
+	clock := limitertest.NewFakeClock(time.Now().Add(time.Hour))
+	nl := NewLimiter(1,
+		WithExpectedServiceTime(50*time.Millisecond),
+		WithClock(clock),
+		WithExecutor(limiter.Inline),
+	)
+	assert.NoError(t, nl.Wait(context.Background(), High))
+
+	ctx, cancel := context.WithDeadline(context.Background(), clock.Now().Add(80*time.Millisecond))
+	defer cancel()
+	var err error
+	nl.AcquireAsync(ctx, Low, func(p *limiter.Permit, e error) {
+		assert.Nil(t, p)
+		err = e
+	})
+	clock.Advance(60 * time.Millisecond)
+	nl.FinishPriority(High)
+
+	assert.True(t, errors.Is(err, limiter.ErrDeadlineUnattainable))
+	assert.Equal(t, limiter.AdmissionExpired, limiter.Outcome(err))
+	assert.Zero(t, nl.Count())
+	assert.Zero(t, nl.waitListSize())
+}
+
+func TestPriorityLimiterKeepsFIFOWithinPriority(t *testing.T) {
+	nl := NewLimiter(1)
+	ok, _ := nl.proceed(Low)
+	assert.True(t, ok)
+
+	waiters := make([]*queue.Item, 500)
+	for i := range waiters {
+		_, waiters[i] = nl.proceed(Low)
+	}
+
+	for i, w := range waiters {
+		nl.Finish()
+		select {
+		case <-w.Done:
+		default:
+			t.Fatalf("expected waiter %d to be released", i)
+		}
+	}
+}
+
+func TestBucketQueueLimiter(t *testing.T) {
+	nl := NewLimiter(1, WithBucketQueue(), WithDynamicPriorityDuration(time.Hour))
+	ok, _ := nl.proceed(Low)
+	assert.True(t, ok)
+
+	_, low := nl.proceed(Low)
+	_, medium := nl.proceed(Medium)
+	_, high := nl.proceed(High)
+	_, canceled := nl.proceed(High)
+	assert.True(t, nl.removeWaiter(canceled))
+	assert.Equal(t, 3, nl.waitListSize())
+
+	for _, w := range []*queue.Item{high, medium, low} {
+		nl.Finish()
+		select {
+		case <-w.Done:
+		default:
+			t.Fatal("waiters were not released in priority order")
+		}
+	}
+	assert.Equal(t, 1, nl.Count())
+	assert.Zero(t, nl.waitListSize())
+}
+
+func TestMaxWaitingShedsLowerPriorityWaiter(t *testing.T) {
+	nl := NewLimiter(1, WithMaxWaiting(1))
+	assert.NoError(t, nl.Wait(context.Background(), Low))
+
+	low := make(chan error, 1)
+	go func() {
+		low <- nl.Wait(context.Background(), Low)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// a waiter with the same priority is rejected.
+	err := nl.Wait(context.Background(), Low)
+	assert.True(t, errors.Is(err, limiter.ErrRejected))
+	assert.Equal(t, limiter.AdmissionRejected, limiter.Outcome(err))
+
+	high := make(chan error, 1)
+	go func() {
+		high <- nl.Wait(context.Background(), High)
+	}()
+
+	err = <-low
+	assert.True(t, errors.Is(err, limiter.ErrShed))
+	assert.Equal(t, limiter.AdmissionShed, limiter.Outcome(err))
+	assert.Equal(t, 1, nl.waitListSize())
+
+	nl.Finish()
+	assert.NoError(t, <-high)
+	nl.Finish()
+	assert.Zero(t, nl.Count())
+}
+
+func TestPriorityAdmissionErrorOutcomes(t *testing.T) {
+	nl := NewLimiter(1, WithTimeoutDuration(20*time.Millisecond), WithExpectedServiceTime(time.Second))
+	assert.NoError(t, nl.Wait(context.Background(), High))
+
+	err := nl.Wait(context.Background(), Low)
+	assert.True(t, errors.Is(err, limiter.ErrTimeout))
+	assert.Equal(t, limiter.AdmissionTimedOut, limiter.Outcome(err))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = nl.Wait(ctx, Low)
+	assert.True(t, errors.Is(err, limiter.ErrDeadlineUnattainable))
+	assert.Equal(t, limiter.AdmissionExpired, limiter.Outcome(err))
+
+	nl.Finish()
+	assert.Zero(t, nl.Count())
+}
+
+func TestPriorityRunWithFallback(t *testing.T) {
+	nl := NewLimiter(1, WithTimeoutDuration(20*time.Millisecond))
+
+	var primaryCalls int32
+	primary := func() error {
+		atomic.AddInt32(&primaryCalls, 1)
+		return nil
+	}
+	var reason limiter.AdmissionResult
+	fallback := func(ctx context.Context, result limiter.AdmissionResult) error {
+		reason = result
+		return nil
+	}
+
+	assert.NoError(t, nl.RunWithFallback(context.Background(), High, primary, fallback))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&primaryCalls))
+	assert.Zero(t, nl.Count())
+
+	assert.NoError(t, nl.Wait(context.Background(), High))
+	assert.NoError(t, nl.RunWithFallback(context.Background(), Low, primary, fallback))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&primaryCalls))
+	assert.Equal(t, limiter.AdmissionTimedOut, reason)
+	assert.Zero(t, nl.Stats().Bypassed)
+
+	nl.Finish()
+	assert.Zero(t, nl.Count())
+}
+
+func TestPriorityBypassBudgetLimitsBypassedGoroutines(t *testing.T) {
+	nl := NewLimiter(1, WithTimeoutDuration(20*time.Millisecond), WithBypassBudget(1))
+	assert.NoError(t, nl.Wait(context.Background(), High))
+
+	result, err := nl.WaitOrBypass(context.Background(), Low)
+	assert.NoError(t, err)
+	assert.Equal(t, limiter.AdmissionBypassed, result)
+	assert.Equal(t, 1, nl.Stats().Bypassed)
+
+	var reason limiter.AdmissionResult
+	err = nl.RunWithFallback(context.Background(), Low, func() error {
+		t.Fatal("primary must not run without capacity")
+		return nil
+	}, func(ctx context.Context, result limiter.AdmissionResult) error {
+		reason = result
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, limiter.AdmissionTimedOut, reason)
+
+	nl.FinishBypass()
+	assert.Zero(t, nl.Stats().Bypassed)
+
+	nl.Finish()
+	assert.Zero(t, nl.Count())
+}
+
+func TestPriorityCloseFailsCurrentAndFutureWaiters(t *testing.T) {
+	nl := NewLimiter(1)
+	assert.NoError(t, nl.Wait(context.Background(), Low))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- nl.Wait(context.Background(), High)
+	}()
+	ticket := nl.Enqueue(Medium)
+	time.Sleep(20 * time.Millisecond)
+
+	nl.Close()
+	err := <-done
+	assert.True(t, errors.Is(err, limiter.ErrClosed))
+	assert.Equal(t, limiter.AdmissionClosed, limiter.Outcome(err))
+	assert.True(t, errors.Is(ticket.Wait(context.Background()), limiter.ErrClosed))
+	assert.Zero(t, nl.waitListSize())
+	assert.True(t, errors.Is(nl.Wait(context.Background(), High), limiter.ErrClosed))
+
+	nl.Finish()
+	assert.Zero(t, nl.Count())
+}
+
+func TestPriorityDrainWaitsForInFlightWork(t *testing.T) {
+	nl := NewLimiter(1)
+	assert.NoError(t, nl.Wait(context.Background(), Low))
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- nl.Drain(context.Background())
+	}()
+
+	select {
+	case <-drained:
+		t.Fatal("drain returned before the in-flight work finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	nl.FinishPriority(Low)
+	assert.NoError(t, <-drained)
+}
+
+func TestPriorityPauseAdmitsExemptPriority(t *testing.T) {
+	nl := NewLimiter(2, WithAdmitWhilePaused(High))
+	nl.Pause()
+	assert.True(t, nl.Paused())
+
+	ok, low := nl.proceed(Low)
+	assert.False(t, ok)
+	ok, _ = nl.proceed(High)
+	assert.True(t, ok)
+	ok, high := nl.proceed(High)
+	assert.True(t, ok)
+	assert.Nil(t, high)
+
+	nl.FinishPriority(High)
+	select {
+	case <-low.Done:
+		t.Fatal("did not expect low priority waiter to be admitted while paused")
+	default:
+	}
+
+	nl.Resume()
+	select {
+	case <-low.Done:
+	default:
+		t.Fatal("expected low priority waiter to be admitted after resume")
+	}
+	assert.Equal(t, 2, nl.Count())
+}
+
+func TestPriorityExpiredLeaseIsReclaimed(t *testing.T) {
+	expired := make(chan limiter.Lease, 1)
+	nl := NewLimiter(1,
+		WithLeaseDuration(20*time.Millisecond),
+		WithLeaseExpiredHook(func(lease limiter.Lease) {
+			expired <- lease
+		}),
+	)
+
+	permit, err := nl.Acquire(context.Background(), Low)
+	assert.NoError(t, err)
+
+	lease := <-expired
+	assert.Nil(t, lease.Stack)
+	assert.Zero(t, nl.Count())
+	assert.False(t, permit.Release())
+	assert.Empty(t, nl.Stats().InUseByPriority)
+}
+
+func TestPriorityRunReleasesOnPanic(t *testing.T) {
+	nl := NewLimiter(1)
+
+	assert.Panics(t, func() {
+		_ = nl.Run(context.Background(), High, func() error {
+			panic("boom")
+		})
+	})
+	assert.Zero(t, nl.Count())
+}
+
+func TestPriorityFakeClockTimeout(t *testing.T) {
+	clock := limitertest.NewFakeClock(time.Now())
+	nl := NewLimiter(1,
+		WithTimeoutDuration(10*time.Millisecond),
+		WithClock(clock),
+	)
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, High))
+
+	errs := make(chan error)
+	go func() {
+		errs <- nl.Wait(ctx, Low)
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(10 * time.Millisecond)
+
+	var admissionErr *limiter.AdmissionError
+	if assert.True(t, errors.As(<-errs, &admissionErr)) {
+		assert.Equal(t, limiter.AdmissionTimedOut, admissionErr.Result)
+		assert.Equal(t, 10*time.Millisecond, admissionErr.Waited)
+	}
+	assert.Equal(t, 0, nl.waitListSize())
+}
+
+func TestPriorityFakeClockAging(t *testing.T) {
+	clock := limitertest.NewFakeClock(time.Now())
+	nl := NewLimiter(1,
+		WithDynamicPriorityDuration(10*time.Millisecond),
+		WithClock(clock),
+	)
+	ctx := context.Background()
+	assert.NoError(t, nl.Wait(ctx, High))
+
+	acquired := make(chan struct{})
+	go func() {
+		_ = nl.Wait(ctx, Low)
+		close(acquired)
+	}()
+	clock.BlockUntil(1)
+	front := func() int {
+		nl.mu.Lock()
+		defer nl.mu.Unlock()
+		return nl.queue.Front().Priority
+	}
+	for _, expected := range []PriorityValue{Medium, MediumHigh} {
+		clock.Advance(10 * time.Millisecond)
+		assert.Eventually(t, func() bool {
+			return front() == int(expected)
+		}, time.Second, time.Millisecond)
+	}
+
+	// the aged waiter was enqueued first , so it is ahead of a new waiter of the same priority.
+	ticket := nl.Enqueue(MediumHigh)
+	nl.Finish()
+	<-acquired
+	assert.False(t, ticket.Acquired())
+	assert.True(t, ticket.Cancel())
+}
+
+func TestPriorityFakeClockFIFO(t *testing.T) {
+	clock := limitertest.NewFakeClock(time.Now())
+	nl := NewLimiter(1, WithClock(clock))
+	assert.NoError(t, nl.Wait(context.Background(), High))
+
+	// the clock does not move , the enqueue order alone breaks the ties.
+	tickets := make([]*Ticket, 3)
+	for i := range tickets {
+		tickets[i] = nl.Enqueue(Medium)
+	}
+	for i, ticket := range tickets {
+		nl.Finish()
+		assert.True(t, ticket.Acquired())
+		for _, later := range tickets[i+1:] {
+			assert.False(t, later.Acquired())
+		}
+	}
+}
+
+// BenchmarkPriorityMassCancellation cancels every goroutine of a full waitlist at once.
+func BenchmarkPriorityMassCancellation(b *testing.B) {
+	for _, n := range []int{1000, 10000} {
+		for _, bucket := range []bool{false, true} {
+			b.Run(fmt.Sprintf("waiters=%d/bucket=%v", n, bucket), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					var options []Option
+					if bucket {
+						options = append(options, WithBucketQueue())
+					}
+					nl := NewLimiter(1, options...)
+					_ = nl.Wait(context.Background(), High)
+					ctx, cancel := context.WithCancel(context.Background())
+					var wg sync.WaitGroup
+					wg.Add(n)
+					for j := 0; j < n; j++ {
+						go func(j int) {
+							defer wg.Done()
+							_ = nl.Wait(ctx, PriorityValue(j%4+1))
+						}(j)
+					}
+					for nl.waitListSize() != n {
+						runtime.Gosched()
+					}
+					b.StartTimer()
+					cancel()
+					wg.Wait()
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package priority
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/queue"
+)
+
+// ErrTicketCanceled is returned by Ticket.Wait when the ticket was canceled while queued.
+var ErrTicketCanceled = errors.New("priority: ticket canceled")
+
+// Ticket is a place in the PriorityLimiter waitlist which can be reprioritized or canceled
+// while it is queued. Acquisition is reported through the ticket.
+type Ticket struct {
+	p *PriorityLimiter
+	w *queue.Item
+
+	// start and position describe when and behind how many waiters the ticket was enqueued.
+	start    time.Time
+	position int
+
+	// guarded by p.mu
+	priority PriorityValue
+	canceled bool
+	// held is set while the ticket holds a slot which Finish hasn't released yet.
+	held bool
+	// acquisition is the record of the slot when tracking is enabled.
+	acquisition *list.Element
+	// err is set when the ticket was rejected or removed from the waitlist by another goroutine.
+	err error
+}
+
+// Enqueue acquires a slot if one is free , otherwise it adds the goroutine to the waitlist
+// and returns immediately. Use the returned ticket to wait for the slot , change the priority
+// or leave the waitlist.
+func (p *PriorityLimiter) Enqueue(priority PriorityValue) *Ticket {
+	start := p.clock.Now()
+	_, w, position, err := p.enqueue(priority, time.Time{}, nil)
+	t := &Ticket{
+		p:        p,
+		w:        w,
+		start:    start,
+		position: position,
+		priority: priority,
+	}
+	if err != nil {
+		t.err = p.admissionError(enqueueOutcome(err), err, start, position)
+	} else if w == nil {
+		t.held = true
+		t.acquisition = p.record(p.acquisition())
+	}
+	return t
+}
+
+// Wait waits until the ticket acquires a slot , the context is done or the limiter timeout expires.
+// The timeout and dynamic priority configured on the limiter start when Wait is called.
+// It returns nil only when the ticket acquired a slot , otherwise it returns a
+// *limiter.AdmissionError describing the outcome.
+func (t *Ticket) Wait(ctx context.Context) error {
+	if t.w == nil {
+		return t.err
+	}
+	if _, err := t.p.await(ctx, t.w, false); err != nil {
+		return t.p.awaitError(err, t.start, t.position)
+	}
+	outcome, removed := t.p.takeRemoved(t.w)
+	a := t.p.acquisition()
+	t.p.mu.Lock()
+	defer t.p.unlock()
+	if removed {
+		t.err = t.p.admissionError(outcome, outcomeErrors[outcome], t.start, t.position)
+	}
+	if t.err != nil {
+		return t.err
+	}
+	if t.canceled {
+		return t.p.admissionError(limiter.AdmissionCanceled, ErrTicketCanceled, t.start, t.position)
+	}
+	t.held = true
+	if t.acquisition == nil {
+		t.acquisition = t.p.recordLocked(a)
+	}
+	return nil
+}
+
+// Acquired reports whether the ticket holds a slot.
+func (t *Ticket) Acquired() bool {
+	if t.w == nil {
+		return t.err == nil
+	}
+	t.p.mu.Lock()
+	defer t.p.unlock()
+	if _, removed := t.p.removed[t.w]; removed || t.canceled || t.err != nil {
+		return false
+	}
+	return !t.p.queue.Contains(t.w)
+}
+
+// Reprioritize changes the priority of the queued ticket. Among the waiters of the new priority
+// the ticket is ordered by the time it was enqueued. It returns false if the ticket is no longer queued.
+func (t *Ticket) Reprioritize(priority PriorityValue) bool {
+	if t.w == nil {
+		return false
+	}
+	t.p.mu.Lock()
+	defer t.p.unlock()
+	if !t.p.queue.Contains(t.w) {
+		return false
+	}
+	t.priority = priority
+	t.p.classes[t.w] = priority
+	t.p.queue.Update(t.w, int(priority))
+	t.p.dispatch()
+	return true
+}
+
+// Cancel removes the ticket from the waitlist. It returns false if the ticket was not queued ,
+// in which case the slot may have been acquired and must still be released with Finish.
+func (t *Ticket) Cancel() bool {
+	if t.w == nil {
+		return false
+	}
+	t.p.mu.Lock()
+	defer t.p.unlock()
+	if t.canceled {
+		return false
+	}
+	if ok := t.p.removeWaiterLocked(t.w); !ok {
+		return false
+	}
+	t.canceled = true
+	return true
+}
+
+// Finish releases the slot acquired by the ticket. It does nothing if the ticket doesn't hold
+// a slot , so it's safe to call after a failed Wait or more than once.
+func (t *Ticket) Finish() {
+	t.p.mu.Lock()
+	if !t.held {
+		t.p.unlock()
+		return
+	}
+	t.held = false
+	priority := t.priority
+	if t.acquisition != nil {
+		t.p.acquisitions.Remove(t.acquisition)
+		t.acquisition = nil
+	}
+	t.p.unlock()
+	t.p.finish(priority)
+}
@@ -0,0 +1,141 @@
+package priority
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+func TestTicketAcquiresImmediately(t *testing.T) {
+	nl := NewLimiter(1)
+	ticket := nl.Enqueue(Low)
+
+	assert.True(t, ticket.Acquired())
+	assert.NoError(t, ticket.Wait(context.Background()))
+	assert.False(t, ticket.Reprioritize(High))
+	assert.False(t, ticket.Cancel())
+
+	ticket.Finish()
+	assert.Zero(t, nl.Count())
+}
+
+func TestTicketReprioritize(t *testing.T) {
+	nl := NewLimiter(1)
+	holder := nl.Enqueue(Low)
+
+	low := nl.Enqueue(Low)
+	medium := nl.Enqueue(Medium)
+	assert.False(t, low.Acquired())
+
+	assert.True(t, low.Reprioritize(High))
+	holder.Finish()
+
+	assert.NoError(t, low.Wait(context.Background()))
+	assert.True(t, low.Acquired())
+	assert.False(t, medium.Acquired())
+	assert.Equal(t, map[PriorityValue]int{High: 1}, nl.Stats().InUseByPriority)
+
+	low.Finish()
+	assert.NoError(t, medium.Wait(context.Background()))
+	medium.Finish()
+	assert.Zero(t, nl.Count())
+}
+
+func TestTicketCancelWhileWaiting(t *testing.T) {
+	nl := NewLimiter(1)
+	holder := nl.Enqueue(Low)
+	ticket := nl.Enqueue(Low)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- ticket.Wait(context.Background())
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, ticket.Cancel())
+	assert.False(t, ticket.Cancel())
+	err := <-done
+	assert.True(t, errors.Is(err, ErrTicketCanceled))
+	assert.Equal(t, limiter.AdmissionCanceled, limiter.Outcome(err))
+	assert.False(t, ticket.Acquired())
+	assert.Zero(t, nl.waitListSize())
+
+	holder.Finish()
+	assert.Zero(t, nl.Count())
+}
+
+func TestTicketWaitUsesLimiterTimeout(t *testing.T) {
+	nl := NewLimiter(1, WithTimeoutDuration(20*time.Millisecond))
+	holder := nl.Enqueue(High)
+	ticket := nl.Enqueue(Low)
+
+	err := ticket.Wait(context.Background())
+	assert.True(t, errors.Is(err, limiter.ErrTimeout))
+	assert.Equal(t, limiter.AdmissionTimedOut, limiter.Outcome(err))
+	var admissionErr *limiter.AdmissionError
+	if assert.True(t, errors.As(err, &admissionErr)) {
+		assert.True(t, admissionErr.Waited >= 20*time.Millisecond)
+	}
+	assert.False(t, ticket.Reprioritize(High))
+	assert.Zero(t, nl.waitListSize())
+
+	holder.Finish()
+	assert.Zero(t, nl.Count())
+}
+
+func TestTicketWaitReportsOutcome(t *testing.T) {
+	nl := NewLimiter(1)
+	holder := nl.Enqueue(High)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := nl.Enqueue(Low).Wait(ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, limiter.AdmissionCanceled, limiter.Outcome(err))
+
+	ticket := nl.Enqueue(Low)
+	nl.Close()
+	err = ticket.Wait(context.Background())
+	assert.True(t, errors.Is(err, limiter.ErrClosed))
+	assert.Equal(t, limiter.AdmissionClosed, limiter.Outcome(err))
+	assert.Equal(t, err, ticket.Wait(context.Background()))
+
+	holder.Finish()
+	assert.Zero(t, nl.Count())
+}
+
+func TestTicketFinishWithoutSlot(t *testing.T) {
+	nl := NewLimiter(1, WithMaxWaiting(1))
+	holder := nl.Enqueue(Low)
+
+	canceled := nl.Enqueue(Low)
+	assert.True(t, canceled.Cancel())
+	canceled.Finish()
+	assert.Equal(t, 1, nl.Count())
+
+	queued := nl.Enqueue(Low)
+	rejected := nl.Enqueue(Low)
+	assert.True(t, errors.Is(rejected.Wait(context.Background()), limiter.ErrRejected))
+	rejected.Finish()
+	assert.Equal(t, 1, nl.Count())
+
+	assert.True(t, queued.Cancel())
+	holder.Finish()
+	assert.Zero(t, nl.Count())
+}
+
+func TestTicketFinishTwice(t *testing.T) {
+	nl := NewLimiter(2)
+	first := nl.Enqueue(Low)
+	second := nl.Enqueue(Low)
+
+	first.Finish()
+	first.Finish()
+	assert.Equal(t, 1, nl.Count())
+
+	second.Finish()
+	assert.Zero(t, nl.Count())
+}
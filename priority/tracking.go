@@ -0,0 +1,87 @@
+package priority
+
+import (
+	"container/list"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+)
+
+// WithTracking records the stack of every acquisition until it is released , see Outstanding.
+// Acquisitions made with Wait are attributed approximately , see limiter.Acquisition.Approximate.
+// It is meant for tests as capturing the stack is expensive.
+func WithTracking() func(*PriorityLimiter) {
+	return func(p *PriorityLimiter) {
+		p.tracking = true
+	}
+}
+
+// Outstanding returns the acquisitions which were not released yet , oldest first. It returns nil
+// unless WithTracking is enabled. Finish and FinishPriority can't tell which slot acquired with
+// Wait they release and forget the oldest one.
+func (p *PriorityLimiter) Outstanding() []limiter.Acquisition {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.tracking {
+		return nil
+	}
+	acquisitions := make([]limiter.Acquisition, 0, p.acquisitions.Len())
+	for e := p.acquisitions.Front(); e != nil; e = e.Next() {
+		acquisitions = append(acquisitions, e.Value.(limiter.Acquisition))
+	}
+	return acquisitions
+}
+
+// acquisition records the calling goroutine if tracking is enabled.
+func (p *PriorityLimiter) acquisition() limiter.Acquisition {
+	if !p.tracking {
+		return limiter.Acquisition{}
+	}
+	return limiter.NewAcquisition(p.clock)
+}
+
+// record stores an acquisition until it is forgotten. It returns nil unless tracking is enabled.
+func (p *PriorityLimiter) record(a limiter.Acquisition) *list.Element {
+	if !p.tracking {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.recordLocked(a)
+}
+
+// recordLocked is record for callers holding p.mu.
+func (p *PriorityLimiter) recordLocked(a limiter.Acquisition) *list.Element {
+	if !p.tracking {
+		return nil
+	}
+	return p.acquisitions.PushBack(a)
+}
+
+// recordWait records an acquisition made with Wait if tracking is enabled.
+func (p *PriorityLimiter) recordWait() {
+	if !p.tracking {
+		return
+	}
+	a := limiter.NewAcquisition(p.clock)
+	a.Approximate = true
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.waits.PushBack(p.acquisitions.PushBack(a))
+}
+
+// forgetWait forgets the oldest acquisition made with Wait. Callers must hold p.mu.
+func (p *PriorityLimiter) forgetWait() {
+	if e := p.waits.Front(); e != nil {
+		p.acquisitions.Remove(p.waits.Remove(e).(*list.Element))
+	}
+}
+
+// forget removes an acquisition stored by record , it is safe to call more than once.
+func (p *PriorityLimiter) forget(e *list.Element) {
+	if e == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.acquisitions.Remove(e)
+}
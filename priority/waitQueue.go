@@ -0,0 +1,84 @@
+package priority
+
+import (
+	"github.com/vivek-ng/concurrency-limiter/queue"
+)
+
+// waitQueue is the waitlist of a PriorityLimiter.
+type waitQueue interface {
+	Len() int
+	Push(w *queue.Item)
+	// Front returns the waiter with the highest priority or nil.
+	Front() *queue.Item
+	Contains(w *queue.Item) bool
+	Remove(w *queue.Item) bool
+	Update(w *queue.Item, priority int)
+	// Less reports whether waiter a is served before waiter b.
+	Less(a, b *queue.Item) bool
+	Each(fn func(w *queue.Item))
+}
+
+// heapQueue adapts queue.Heap to waitQueue.
+type heapQueue struct {
+	heap    *queue.Heap[*queue.Item]
+	handles map[*queue.Item]*queue.Handle[*queue.Item]
+}
+
+func newHeapQueue() *heapQueue {
+	return &heapQueue{
+		heap:    queue.NewHeap(before),
+		handles: make(map[*queue.Item]*queue.Handle[*queue.Item]),
+	}
+}
+
+// before orders waiters by priority and then deadline , the heap keeps the waiters which are
+// otherwise equal in the order they were pushed.
+func before(a, b *queue.Item) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	return queue.EarlierDeadline(a.Deadline, b.Deadline)
+}
+
+func (h *heapQueue) Len() int { return h.heap.Len() }
+
+func (h *heapQueue) Push(w *queue.Item) { h.handles[w] = h.heap.Push(w) }
+
+func (h *heapQueue) Front() *queue.Item {
+	handle, ok := h.heap.Peek()
+	if !ok {
+		return nil
+	}
+	return handle.Value
+}
+
+func (h *heapQueue) Contains(w *queue.Item) bool {
+	_, ok := h.handles[w]
+	return ok
+}
+
+func (h *heapQueue) Remove(w *queue.Item) bool {
+	handle, ok := h.handles[w]
+	if !ok {
+		return false
+	}
+	delete(h.handles, w)
+	return h.heap.Remove(handle)
+}
+
+func (h *heapQueue) Update(w *queue.Item, priority int) {
+	w.Priority = priority
+	if handle, ok := h.handles[w]; ok {
+		h.heap.Fix(handle)
+	}
+}
+
+func (h *heapQueue) Less(a, b *queue.Item) bool {
+	return h.heap.Less(h.handles[a], h.handles[b])
+}
+
+func (h *heapQueue) Each(fn func(w *queue.Item)) {
+	h.heap.Each(func(handle *queue.Handle[*queue.Item]) {
+		fn(handle.Value)
+	})
+}
@@ -0,0 +1,141 @@
+package queue
+
+import "math/bits"
+
+// MaxBucketPriority is the highest priority level of a BucketQueue.
+const MaxBucketPriority = 63
+
+// BucketQueue is a priority queue for a small fixed set of priorities. It keeps a FIFO list
+// per priority level and a bitmap of the non-empty levels , so Push , Pop , Remove and Update
+// are O(1). Priorities are clamped to [0, MaxBucketPriority] and deadlines are ignored.
+// BucketQueue is not safe for concurrent use.
+type BucketQueue struct {
+	heads  [MaxBucketPriority + 1]*Item
+	tails  [MaxBucketPriority + 1]*Item
+	bitmap uint64
+	len    int
+	// sequence numbers the pushed items , it orders the items of a level in Less.
+	sequence uint64
+}
+
+// NewBucketQueue creates an empty BucketQueue.
+func NewBucketQueue() *BucketQueue {
+	return &BucketQueue{}
+}
+
+// Len returns the number of items in the queue.
+func (bq *BucketQueue) Len() int { return bq.len }
+
+// Push adds the item to the back of its priority level.
+func (bq *BucketQueue) Push(item *Item) {
+	bq.sequence++
+	item.sequence = bq.sequence
+	level := bucketLevel(item.Priority)
+	item.index = level
+	item.bucket = bq
+	item.next = nil
+	item.prev = bq.tails[level]
+	if item.prev != nil {
+		item.prev.next = item
+	} else {
+		bq.heads[level] = item
+	}
+	bq.tails[level] = item
+	bq.bitmap |= 1 << uint(level)
+	bq.len++
+}
+
+// Front returns the oldest item of the highest non-empty priority level or nil.
+func (bq *BucketQueue) Front() *Item {
+	if bq.bitmap == 0 {
+		return nil
+	}
+	return bq.heads[bits.Len64(bq.bitmap)-1]
+}
+
+// Pop removes and returns the item returned by Front or nil if the queue is empty.
+func (bq *BucketQueue) Pop() *Item {
+	item := bq.Front()
+	if item != nil {
+		bq.unlink(item)
+	}
+	return item
+}
+
+// Contains reports whether the item is in the queue.
+func (bq *BucketQueue) Contains(item *Item) bool {
+	return item.bucket == bq
+}
+
+// Remove removes the item from the queue. It returns false if the item is not in the queue.
+func (bq *BucketQueue) Remove(item *Item) bool {
+	if !bq.Contains(item) {
+		return false
+	}
+	bq.unlink(item)
+	return true
+}
+
+// Update changes the priority of the item and moves it to the back of the new priority level.
+func (bq *BucketQueue) Update(item *Item, priority int) {
+	if !bq.Contains(item) {
+		item.Priority = priority
+		return
+	}
+	bq.unlink(item)
+	item.Priority = priority
+	bq.Push(item)
+}
+
+// Less reports whether item a is popped before item b.
+func (bq *BucketQueue) Less(a, b *Item) bool {
+	la, lb := bucketLevel(a.Priority), bucketLevel(b.Priority)
+	if la == lb {
+		return a.sequence < b.sequence
+	}
+	return la > lb
+}
+
+// Each calls fn for every item in pop order.
+func (bq *BucketQueue) Each(fn func(item *Item)) {
+	for bitmap := bq.bitmap; bitmap != 0; {
+		level := bits.Len64(bitmap) - 1
+		bitmap &^= 1 << uint(level)
+		for item := bq.heads[level]; item != nil; {
+			// fn may remove the item.
+			next := item.next
+			fn(item)
+			item = next
+		}
+	}
+}
+
+func (bq *BucketQueue) unlink(item *Item) {
+	level := item.index
+	if item.prev != nil {
+		item.prev.next = item.next
+	} else {
+		bq.heads[level] = item.next
+	}
+	if item.next != nil {
+		item.next.prev = item.prev
+	} else {
+		bq.tails[level] = item.prev
+	}
+	if bq.heads[level] == nil {
+		bq.bitmap &^= 1 << uint(level)
+	}
+	item.prev, item.next, item.bucket = nil, nil, nil
+	item.index = -1
+	bq.len--
+}
+
+func bucketLevel(priority int) int {
+	if priority < 0 {
+		return 0
+	}
+	if priority > MaxBucketPriority {
+		return MaxBucketPriority
+	}
+	return priority
+}
@@ -0,0 +1,167 @@
+package queue
+
+import (
+	"container/heap"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketQueue(t *testing.T) {
+	bq := NewBucketQueue()
+	assert.Nil(t, bq.Front())
+	assert.Nil(t, bq.Pop())
+
+	items := make([]*Item, 6)
+	for i, priority := range []int{1, 4, 2, 4, 1, 100} {
+		items[i] = &Item{Priority: priority}
+		bq.Push(items[i])
+	}
+	assert.Equal(t, 6, bq.Len())
+	assert.Same(t, items[5], bq.Front())
+
+	assert.True(t, bq.Remove(items[5]))
+	assert.False(t, bq.Remove(items[5]))
+	assert.False(t, bq.Contains(items[5]))
+
+	// promoted to the back of level 4.
+	bq.Update(items[4], 4)
+
+	var order []*Item
+	bq.Each(func(it *Item) {
+		order = append(order, it)
+	})
+	expected := []*Item{items[1], items[3], items[4], items[2], items[0]}
+	assert.Equal(t, expected, order)
+	for i := 1; i < len(expected); i++ {
+		assert.True(t, bq.Less(expected[i-1], expected[i]))
+	}
+
+	for _, it := range expected {
+		assert.Same(t, it, bq.Pop())
+	}
+	assert.Zero(t, bq.Len())
+}
+
+var benchmarkSizes = []int{100, 10000, 1000000}
+
+func fillPriorityQueue(n int) (*PriorityQueue, []*Item) {
+	pq := make(PriorityQueue, 0, n)
+	items := make([]*Item, n)
+	for i := range items {
+		items[i] = &Item{Priority: 1 + i%4}
+		heap.Push(&pq, items[i])
+	}
+	return &pq, items
+}
+
+func fillBucketQueue(n int) (*BucketQueue, []*Item) {
+	bq := NewBucketQueue()
+	items := make([]*Item, n)
+	for i := range items {
+		items[i] = &Item{Priority: 1 + i%4}
+		bq.Push(items[i])
+	}
+	return bq, items
+}
+
+func BenchmarkPriorityQueuePushPop(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("waiters=%d", n), func(b *testing.B) {
+			pq, _ := fillPriorityQueue(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				heap.Push(pq, &Item{Priority: 1 + i%4})
+				heap.Pop(pq)
+			}
+		})
+	}
+}
+
+func BenchmarkBucketQueuePushPop(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("waiters=%d", n), func(b *testing.B) {
+			bq, _ := fillBucketQueue(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				bq.Push(&Item{Priority: 1 + i%4})
+				bq.Pop()
+			}
+		})
+	}
+}
+
+func BenchmarkPriorityQueueRemovePush(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("waiters=%d", n), func(b *testing.B) {
+			pq, items := fillPriorityQueue(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				it := items[i%n]
+				idx, _ := pq.FindIndex(it)
+				heap.Remove(pq, idx)
+				heap.Push(pq, it)
+			}
+		})
+	}
+}
+
+func BenchmarkBucketQueueRemovePush(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("waiters=%d", n), func(b *testing.B) {
+			bq, items := fillBucketQueue(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				it := items[i%n]
+				bq.Remove(it)
+				bq.Push(it)
+			}
+		})
+	}
+}
+
+func BenchmarkPriorityQueuePromote(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("waiters=%d", n), func(b *testing.B) {
+			pq, items := fillPriorityQueue(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				it := items[i%n]
+				pq.Update(it, 1+(it.Priority%4))
+			}
+		})
+	}
+}
+
+func BenchmarkBucketQueuePromote(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("waiters=%d", n), func(b *testing.B) {
+			bq, items := fillBucketQueue(n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				it := items[i%n]
+				bq.Update(it, 1+(it.Priority%4))
+			}
+		})
+	}
+}
+
+func TestBucketQueueOwnsSequence(t *testing.T) {
+	before := atomic.LoadUint64(&sequence)
+	a, b := NewBucketQueue(), NewBucketQueue()
+	var items []*Item
+	for i := 0; i < 3; i++ {
+		for _, bq := range []*BucketQueue{a, b} {
+			item := &Item{Priority: 1}
+			bq.Push(item)
+			items = append(items, item)
+		}
+	}
+	// every queue numbers its own items , the package counter of PriorityQueue is not used.
+	for i, item := range items {
+		assert.Equal(t, uint64(i/2+1), item.sequence)
+	}
+	assert.Equal(t, before, atomic.LoadUint64(&sequence))
+}
@@ -0,0 +1,158 @@
+package queue
+
+import "container/heap"
+
+// Handle refers to an element pushed to a Heap. It can be used to update or remove the
+// element in O(log n).
+type Handle[T any] struct {
+	// Value is the element stored in the heap. Call Heap.Fix after changing it in place.
+	Value    T
+	sequence uint64
+	index    int
+	owner    *heapData[T]
+}
+
+// Heap is a type safe priority queue ordered by a user supplied function.
+// Elements which are equal according to the ordering are popped in the order they were pushed.
+// Heap is not safe for concurrent use.
+type Heap[T any] struct {
+	data heapData[T]
+}
+
+// NewHeap creates an empty Heap. less reports whether a must be popped before b.
+func NewHeap[T any](less func(a, b T) bool) *Heap[T] {
+	return &Heap[T]{
+		data: heapData[T]{less: less},
+	}
+}
+
+// Len returns the number of elements in the heap.
+func (h *Heap[T]) Len() int { return len(h.data.items) }
+
+// Push adds the value to the heap and returns its handle.
+func (h *Heap[T]) Push(value T) *Handle[T] {
+	h.data.sequence++
+	handle := &Handle[T]{
+		Value:    value,
+		sequence: h.data.sequence,
+		owner:    &h.data,
+	}
+	heap.Push(&h.data, handle)
+	return handle
+}
+
+// Pop removes and returns the first value. It returns false if the heap is empty.
+func (h *Heap[T]) Pop() (T, bool) {
+	if len(h.data.items) == 0 {
+		var zero T
+		return zero, false
+	}
+	handle := heap.Pop(&h.data).(*Handle[T])
+	return handle.Value, true
+}
+
+// Peek returns the handle of the first element without removing it.
+// It returns false if the heap is empty.
+func (h *Heap[T]) Peek() (*Handle[T], bool) {
+	if len(h.data.items) == 0 {
+		return nil, false
+	}
+	return h.data.items[0], true
+}
+
+// Contains reports whether the handle's element is still in the heap.
+func (h *Heap[T]) Contains(handle *Handle[T]) bool {
+	return handle != nil && handle.owner == &h.data && handle.index >= 0 &&
+		handle.index < len(h.data.items) && h.data.items[handle.index] == handle
+}
+
+// Remove removes the handle's element from the heap. It returns false if the element
+// is no longer in the heap.
+func (h *Heap[T]) Remove(handle *Handle[T]) bool {
+	if !h.Contains(handle) {
+		return false
+	}
+	heap.Remove(&h.data, handle.index)
+	return true
+}
+
+// Update replaces the handle's value and restores the ordering. It returns false if the element
+// is no longer in the heap. The element keeps its push order among equal elements.
+func (h *Heap[T]) Update(handle *Handle[T], value T) bool {
+	if !h.Contains(handle) {
+		return false
+	}
+	handle.Value = value
+	heap.Fix(&h.data, handle.index)
+	return true
+}
+
+// Less reports whether the element of handle a is popped before the element of handle b.
+// Both elements must be in the heap.
+func (h *Heap[T]) Less(a, b *Handle[T]) bool {
+	return h.data.before(a, b)
+}
+
+// Each calls fn for every element of the heap in no particular order. fn must not push or
+// remove elements.
+func (h *Heap[T]) Each(fn func(handle *Handle[T])) {
+	for _, handle := range h.data.items {
+		fn(handle)
+	}
+}
+
+// Fix restores the ordering after the handle's value was changed in place.
+// It returns false if the element is no longer in the heap.
+func (h *Heap[T]) Fix(handle *Handle[T]) bool {
+	if !h.Contains(handle) {
+		return false
+	}
+	heap.Fix(&h.data, handle.index)
+	return true
+}
+
+// heapData implements heap.Interface for Heap.
+type heapData[T any] struct {
+	items    []*Handle[T]
+	less     func(a, b T) bool
+	sequence uint64
+}
+
+func (d *heapData[T]) Len() int { return len(d.items) }
+
+func (d *heapData[T]) Less(i, j int) bool {
+	return d.before(d.items[i], d.items[j])
+}
+
+// before orders the elements with the user supplied function and then in push order.
+func (d *heapData[T]) before(a, b *Handle[T]) bool {
+	if d.less(a.Value, b.Value) {
+		return true
+	}
+	if d.less(b.Value, a.Value) {
+		return false
+	}
+	return a.sequence < b.sequence
+}
+
+func (d *heapData[T]) Swap(i, j int) {
+	d.items[i], d.items[j] = d.items[j], d.items[i]
+	d.items[i].index = i
+	d.items[j].index = j
+}
+
+func (d *heapData[T]) Push(x interface{}) {
+	handle := x.(*Handle[T])
+	handle.index = len(d.items)
+	d.items = append(d.items, handle)
+}
+
+func (d *heapData[T]) Pop() interface{} {
+	old := d.items
+	n := len(old)
+	handle := old[n-1]
+	old[n-1] = nil
+	handle.index = -1
+	d.items = old[0 : n-1]
+	return handle
+}
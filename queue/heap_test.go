@@ -0,0 +1,119 @@
+package queue
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"testing/quick"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type job struct {
+	priority int
+	id       int
+}
+
+func higherPriority(a, b job) bool { return a.priority > b.priority }
+
+func TestHeapOrdering(t *testing.T) {
+	h := NewHeap(higherPriority)
+	_, ok := h.Peek()
+	assert.False(t, ok)
+
+	for i, priority := range []int{1, 3, 2, 3, 1} {
+		h.Push(job{priority: priority, id: i})
+	}
+
+	top, ok := h.Peek()
+	assert.True(t, ok)
+	assert.Equal(t, job{priority: 3, id: 1}, top.Value)
+
+	var ids []int
+	for h.Len() > 0 {
+		j, _ := h.Pop()
+		ids = append(ids, j.id)
+	}
+	assert.Equal(t, []int{1, 3, 2, 0, 4}, ids)
+
+	_, ok = h.Pop()
+	assert.False(t, ok)
+}
+
+func TestHeapUpdateAndRemoveByHandle(t *testing.T) {
+	h := NewHeap(higherPriority)
+	a := h.Push(job{priority: 1, id: 0})
+	b := h.Push(job{priority: 1, id: 1})
+	c := h.Push(job{priority: 1, id: 2})
+
+	assert.True(t, h.Update(c, job{priority: 5, id: 2}))
+	assert.True(t, h.Remove(a))
+	assert.False(t, h.Remove(a))
+	assert.False(t, h.Update(a, job{priority: 9}))
+
+	b.Value.priority = 7
+	assert.True(t, h.Fix(b))
+
+	var ids []int
+	for h.Len() > 0 {
+		j, _ := h.Pop()
+		ids = append(ids, j.id)
+	}
+	assert.Equal(t, []int{1, 2}, ids)
+	assert.False(t, h.Contains(b))
+
+	other := NewHeap(higherPriority)
+	d := other.Push(job{})
+	assert.False(t, h.Contains(d))
+}
+
+func TestHeapStableProperty(t *testing.T) {
+	property := func(seed int64) bool {
+		r := rand.New(rand.NewSource(seed))
+		h := NewHeap(higherPriority)
+		var expected []job
+		handles := make(map[int]*Handle[job])
+		for i := 0; i < 2000; i++ {
+			j := job{priority: r.Intn(4), id: i}
+			handles[i] = h.Push(j)
+			expected = append(expected, j)
+		}
+		kept := expected[:0]
+		for _, j := range expected {
+			if r.Intn(5) == 0 {
+				h.Remove(handles[j.id])
+				continue
+			}
+			kept = append(kept, j)
+		}
+		sort.SliceStable(kept, func(i, j int) bool { return higherPriority(kept[i], kept[j]) })
+
+		for _, want := range kept {
+			got, ok := h.Pop()
+			if !ok || got != want {
+				return false
+			}
+		}
+		return h.Len() == 0
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 20}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHeapLessAndEach(t *testing.T) {
+	h := NewHeap(higherPriority)
+	low := h.Push(job{priority: 1, id: 0})
+	first := h.Push(job{priority: 2, id: 1})
+	second := h.Push(job{priority: 2, id: 2})
+
+	assert.True(t, h.Less(first, low))
+	assert.True(t, h.Less(first, second))
+	assert.False(t, h.Less(second, first))
+
+	ids := make(map[int]bool)
+	h.Each(func(handle *Handle[job]) {
+		ids[handle.Value.id] = true
+	})
+	assert.Equal(t, map[int]bool{0: true, 1: true, 2: true}, ids)
+}
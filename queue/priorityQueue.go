@@ -2,15 +2,29 @@ package queue
 
 import (
 	"container/heap"
+	"sync/atomic"
 	"time"
 )
 
+// sequence is incremented for every item pushed to a PriorityQueue. PriorityQueue is an exported
+// slice type and can't hold a counter of its own without breaking its callers. The counter only
+// grows , so the items of every queue are still numbered in push order , queues merely share it.
+// BucketQueue and Heap count their own pushes and don't touch it.
+var sequence uint64
+
 // Item stores the attributes which will be pushed to the priority queue..
 type Item struct {
-	Done      chan struct{}
-	Priority  int
-	timeStamp int64
-	index     int
+	Done     chan struct{}
+	Priority int
+	// Deadline orders items of the same priority , earlier deadlines first.
+	// Items without a deadline are placed after the items with one.
+	Deadline time.Time
+	sequence uint64
+	index    int
+
+	// links of the BucketQueue level the item is stored in.
+	prev, next *Item
+	bucket     *BucketQueue
 }
 
 // PriorityQueue ....
@@ -22,10 +36,31 @@ func (pq PriorityQueue) Len() int { return len(pq) }
 // Less is used to compare elements and store them in the proper order in
 // priority queue.
 func (pq PriorityQueue) Less(i, j int) bool {
-	if pq[i].Priority == pq[j].Priority {
-		return pq[i].timeStamp <= pq[j].timeStamp
+	return Before(pq[i], pq[j])
+}
+
+// Before reports whether item a is ordered before item b: higher priority first , then
+// earlier deadline and then the order in which the items were pushed.
+func Before(a, b *Item) bool {
+	if a.Priority == b.Priority {
+		if !a.Deadline.Equal(b.Deadline) {
+			return EarlierDeadline(a.Deadline, b.Deadline)
+		}
+		return a.sequence < b.sequence
 	}
-	return pq[i].Priority > pq[j].Priority
+	return a.Priority > b.Priority
+}
+
+// EarlierDeadline reports whether deadline a comes before deadline b.
+// The zero time means no deadline and comes after every other deadline.
+func EarlierDeadline(a, b time.Time) bool {
+	if a.IsZero() {
+		return false
+	}
+	if b.IsZero() {
+		return true
+	}
+	return a.Before(b)
 }
 
 // Swap is used to swap the values in the priority queue.
@@ -35,12 +70,13 @@ func (pq PriorityQueue) Swap(i, j int) {
 	pq[j].index = j
 }
 
-// Push adds elements to the priority queue
+// Push adds elements to the priority queue. Items with the same priority and deadline
+// are popped in the order they were pushed.
 func (pq *PriorityQueue) Push(x interface{}) {
 	n := len(*pq)
 	item := x.(*Item)
 	item.index = n
-	item.timeStamp = makeTimestamp()
+	item.sequence = nextSequence()
 	*pq = append(*pq, item)
 }
 
@@ -55,6 +91,10 @@ func (pq *PriorityQueue) Pop() interface{} {
 	return item
 }
 
+func nextSequence() uint64 {
+	return atomic.AddUint64(&sequence, 1)
+}
+
 // Top returns the topmost element in the priority queue
 func (pq *PriorityQueue) Top() interface{} {
 	n := len(*pq)
@@ -84,7 +124,3 @@ func (pq *PriorityQueue) Update(item *Item, priority int) {
 	item.Priority = priority
 	heap.Fix(pq, item.index)
 }
-
-func makeTimestamp() int64 {
-	return time.Now().UnixNano() / int64(time.Millisecond)
-}
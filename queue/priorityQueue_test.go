@@ -2,7 +2,10 @@ package queue
 
 import (
 	"container/heap"
+	"math/rand"
 	"testing"
+	"testing/quick"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -33,17 +36,17 @@ func TestPriorityQueue_SamePriority(t *testing.T) {
 
 	for i := 0; i < 3; i++ {
 		pq[i] = &Item{
-			Priority:  1,
-			timeStamp: int64(i),
+			Priority: 1,
+			sequence: uint64(i),
 		}
 	}
 
 	pq.Update(pq[2], 3)
-	expectedVals := []int64{2, 0, 1}
-	actualVals := make([]int64, 0)
+	expectedVals := []uint64{2, 0, 1}
+	actualVals := make([]uint64, 0)
 	for pq.Len() > 0 {
 		item := heap.Pop(&pq).(*Item)
-		actualVals = append(actualVals, item.timeStamp)
+		actualVals = append(actualVals, item.sequence)
 	}
 	assert.Equal(t, expectedVals, actualVals)
 }
@@ -52,3 +55,87 @@ func TestTop_nil(t *testing.T) {
 	pq := make(PriorityQueue, 0)
 	assert.Nil(t, pq.Top())
 }
+
+func TestPriorityQueue_DeadlineBreaksTies(t *testing.T) {
+	now := time.Now()
+	pq := make(PriorityQueue, 0)
+	heap.Push(&pq, &Item{Priority: 1})
+	heap.Push(&pq, &Item{Priority: 1, Deadline: now.Add(time.Second)})
+	heap.Push(&pq, &Item{Priority: 1, Deadline: now.Add(time.Millisecond)})
+	heap.Push(&pq, &Item{Priority: 2, Deadline: now.Add(time.Hour)})
+
+	expected := []time.Time{now.Add(time.Hour), now.Add(time.Millisecond), now.Add(time.Second), {}}
+	actual := make([]time.Time, 0)
+	for pq.Len() > 0 {
+		actual = append(actual, heap.Pop(&pq).(*Item).Deadline)
+	}
+	assert.Equal(t, expected, actual)
+}
+
+func TestPriorityQueue_FIFOProperty(t *testing.T) {
+	property := func(seed int64) bool {
+		r := rand.New(rand.NewSource(seed))
+		n := 1000 + r.Intn(4000)
+		pq := make(PriorityQueue, 0)
+		items := make([]*Item, n)
+		for i := range items {
+			items[i] = &Item{Priority: 1}
+			heap.Push(&pq, items[i])
+		}
+
+		removed := make(map[*Item]bool)
+		for i := 0; i < n/10; i++ {
+			it := items[r.Intn(n)]
+			if removed[it] {
+				continue
+			}
+			idx, ok := pq.FindIndex(it)
+			if !ok {
+				return false
+			}
+			if r.Intn(2) == 0 {
+				heap.Remove(&pq, idx)
+				removed[it] = true
+				continue
+			}
+			// an update to the same priority keeps the position.
+			pq.Update(it, 1)
+		}
+
+		for _, it := range items {
+			if removed[it] {
+				continue
+			}
+			if heap.Pop(&pq).(*Item) != it {
+				return false
+			}
+		}
+		return pq.Len() == 0
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 20}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPriorityQueue_FIFOAfterPromotion(t *testing.T) {
+	pq := make(PriorityQueue, 0)
+	items := make([]*Item, 2000)
+	for i := range items {
+		items[i] = &Item{Priority: 1}
+		heap.Push(&pq, items[i])
+	}
+	// promote every other item , the promoted items keep their relative order.
+	var promoted, rest []*Item
+	for i, it := range items {
+		if i%2 == 0 {
+			pq.Update(it, 2)
+			promoted = append(promoted, it)
+		} else {
+			rest = append(rest, it)
+		}
+	}
+
+	for _, it := range append(promoted, rest...) {
+		assert.Same(t, it, heap.Pop(&pq).(*Item))
+	}
+}
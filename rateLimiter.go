@@ -4,21 +4,45 @@ import (
 	"container/list"
 	"context"
 	"errors"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var ErrTimeout = errors.New("limiter: timed out waiting for capacity")
 
+// ErrDeadlineUnattainable is returned when the context deadline is too close for the work to
+// complete , so the caller is rejected instead of using capacity.
+var ErrDeadlineUnattainable = errors.New("limiter: deadline too close to complete the work")
+
+// ErrClosed is returned to waiters when the limiter is closed or drained.
+var ErrClosed = errors.New("limiter: closed")
+
 // waiter is the individual goroutine waiting for accessing the resource.
 // waiter waits for the signal through the done channel.
 type waiter struct {
 	done chan struct{}
+	// err is set before done is closed when the waiter was removed instead of admitted.
+	err error
+	// elem is the waiter's element of the waiting list , nil once it left the list.
+	elem *list.Element
+	// async is set for callers waiting through AcquireAsync.
+	async *asyncWait
 }
 
+// state holds the number of acquired slots in the low 32 bits and the slow flag.
+const (
+	// slow is set while callers must take the mutex , i.e. while goroutines are waiting or the
+	// limiter is paused or closed. Without it slots are acquired and released with atomics only.
+	slow      int64 = 1 << 32
+	countMask int64 = slow - 1
+)
+
 // Limiter stores the configuration need for concurrency limiter....
 type Limiter struct {
-	count int
+	// state is accessed atomically , it is the first field to be 64-bit aligned on 32-bit platforms.
+	state int64
 	// Deprecated: configure via New. Runtime behavior uses an internal snapshot.
 	Limit    int
 	mu       sync.Mutex
@@ -26,8 +50,32 @@ type Limiter struct {
 	// Deprecated: configure via WithTimeoutDuration. Runtime behavior uses an internal snapshot.
 	Timeout *int
 
-	limit   int
-	timeout *time.Duration
+	limit      int
+	timeout    *time.Duration
+	maxWaiting int
+	// bypassing is the number of bypassed callers which did not call FinishBypass yet.
+	bypassing    int
+	bypassBudget int
+	closed       bool
+	paused       bool
+	// idle is closed once the limiter is closed and the count reached zero.
+	idle chan struct{}
+
+	leaseDuration time.Duration
+	leaseStacks   bool
+	onLeaseExpire func(Lease)
+
+	tracking bool
+	// acquisitions are the Acquisition values of the permits which were not released yet.
+	acquisitions list.List
+	// waits are the elements of acquisitions made with Wait , oldest first.
+	waits list.List
+
+	clock Clock
+
+	executor func(func())
+	// pending are the notifications of asynchronous waiters , run by unlock.
+	pending []func()
 }
 
 // Option is a type to configure the Limiter struct....
@@ -39,6 +87,9 @@ func New(limit int, options ...Option) *Limiter {
 	l := &Limiter{
 		Limit: limit,
 		limit: limit,
+		clock: RealClock(),
+
+		executor: goExecutor,
 	}
 
 	for _, o := range options {
@@ -63,140 +114,477 @@ func WithTimeoutDuration(timeout time.Duration) func(*Limiter) {
 	}
 }
 
+// WithMaxWaiting limits the number of goroutines in the waitlist.
+// Wait returns an AdmissionError wrapping ErrRejected when the waitlist is full.
+func WithMaxWaiting(n int) func(*Limiter) {
+	return func(l *Limiter) {
+		l.maxWaiting = n
+	}
+}
+
+// WithBypassBudget limits how many callers bypassed by WaitOrBypass can be in flight at once.
+// When the budget is exhausted a timed out caller is not bypassed and gets ErrTimeout instead.
+// Bypassed callers must call FinishBypass when they are done , RunOrBypass does this for you.
+func WithBypassBudget(n int) func(*Limiter) {
+	return func(l *Limiter) {
+		l.bypassBudget = n
+	}
+}
+
+// WithLeaseDuration limits how long capacity acquired through Acquire or the Run methods can be held.
+// Expired leases are reclaimed so that a goroutine which panics or forgets to release does not shrink
+// the limiter forever. Releasing an expired permit is ignored.
+func WithLeaseDuration(duration time.Duration) func(*Limiter) {
+	return func(l *Limiter) {
+		l.leaseDuration = duration
+	}
+}
+
+// WithLeaseExpiredHook configures a function which is called when a lease expires.
+func WithLeaseExpiredHook(hook func(Lease)) func(*Limiter) {
+	return func(l *Limiter) {
+		l.onLeaseExpire = hook
+	}
+}
+
+// WithLeaseStacks records the stack of the acquirer in every lease. It is meant for debugging
+// as capturing the stack is expensive.
+func WithLeaseStacks() func(*Limiter) {
+	return func(l *Limiter) {
+		l.leaseStacks = true
+	}
+}
+
 // Wait waits until capacity is available or the context/timeout expires.
-// It returns nil only when the caller successfully acquires capacity.
+// It returns nil only when the caller successfully acquires capacity , otherwise it returns
+// an *AdmissionError describing the outcome.
 func (l *Limiter) Wait(ctx context.Context) error {
 	_, err := l.wait(ctx, false)
+	if err == nil {
+		l.recordWait()
+	}
 	return err
 }
 
 // WaitOrBypass waits until capacity is available, or bypasses the limiter after the configured timeout.
-// It returns AdmissionBypassed only when a timeout occurs before capacity is acquired.
+// It returns AdmissionBypassed only when a timeout occurs before capacity is acquired and the bypass
+// budget is not exhausted. Call FinishBypass when the bypassed work is done.
 func (l *Limiter) WaitOrBypass(ctx context.Context) (AdmissionResult, error) {
-	return l.wait(ctx, true)
+	result, err := l.wait(ctx, true)
+	if result == AdmissionAcquired && err == nil {
+		l.recordWait()
+	}
+	return result, err
 }
 
 func (l *Limiter) wait(ctx context.Context, allowBypass bool) (AdmissionResult, error) {
-	ok, ch := l.proceed()
+	if l.tryAcquire() {
+		return AdmissionAcquired, nil
+	}
+	start := l.clock.Now()
+	ok, w, position, err := l.proceed(nil)
 	if ok {
 		return AdmissionAcquired, nil
 	}
+	if err != nil {
+		return 0, l.enqueueError(err, start, position)
+	}
+	return l.await(ctx, w, start, position, allowBypass)
+}
+
+// enqueueError wraps an error returned by proceed.
+func (l *Limiter) enqueueError(err error, start time.Time, position int) *AdmissionError {
+	outcome := AdmissionRejected
+	if err == ErrClosed {
+		outcome = AdmissionClosed
+	}
+	return l.admissionError(outcome, err, start, position)
+}
+
+// await blocks until the queued waiter is admitted or removed by the context or timeout.
+func (l *Limiter) await(ctx context.Context, w *waiter, start time.Time, position int, allowBypass bool) (AdmissionResult, error) {
 	if l.timeout != nil {
-		timer := time.NewTimer(*l.timeout)
+		timer := l.clock.NewTimer(*l.timeout)
 		defer timer.Stop()
 		select {
-		case <-ch:
-			return AdmissionAcquired, nil
-		case <-timer.C:
-			if l.removeWaiter(ch) {
-				if allowBypass {
+		case <-w.done:
+			return l.admitted(w, start, position)
+		case <-timer.C():
+			if l.removeWaiter(w) {
+				if allowBypass && l.bypass() {
 					return AdmissionBypassed, nil
 				}
-				return 0, ErrTimeout
+				return 0, l.admissionError(AdmissionTimedOut, ErrTimeout, start, position)
 			}
-			return AdmissionAcquired, nil
+			return l.admitted(w, start, position)
 		case <-ctx.Done():
-			if l.removeWaiter(ch) {
-				return 0, ctx.Err()
+			if l.removeWaiter(w) {
+				return 0, l.admissionError(AdmissionCanceled, ctx.Err(), start, position)
 			}
-			return AdmissionAcquired, nil
+			return l.admitted(w, start, position)
 		}
 	}
 	select {
-	case <-ch:
-		return AdmissionAcquired, nil
+	case <-w.done:
+		return l.admitted(w, start, position)
 	case <-ctx.Done():
-		if l.removeWaiter(ch) {
-			return 0, ctx.Err()
+		if l.removeWaiter(w) {
+			return 0, l.admissionError(AdmissionCanceled, ctx.Err(), start, position)
 		}
-		return AdmissionAcquired, nil
+		return l.admitted(w, start, position)
 	}
 }
 
-func (l *Limiter) removeWaiter(ch chan struct{}) bool {
+// admitted returns the outcome of a waiter which is no longer in the waiting list.
+func (l *Limiter) admitted(w *waiter, start time.Time, position int) (AdmissionResult, error) {
+	if w.err != nil {
+		return 0, l.admissionError(AdmissionClosed, w.err, start, position)
+	}
+	return AdmissionAcquired, nil
+}
+
+func (l *Limiter) admissionError(result AdmissionResult, err error, start time.Time, position int) *AdmissionError {
+	return &AdmissionError{
+		Result:   result,
+		Waited:   l.clock.Now().Sub(start),
+		Position: position,
+		Err:      err,
+	}
+}
+
+// bypass reserves a place in the bypass budget.
+func (l *Limiter) bypass() bool {
 	l.mu.Lock()
-	defer l.mu.Unlock()
-	for w := l.waitList.Front(); w != nil; w = w.Next() {
-		ele := w.Value.(waiter)
-		if ele.done == ch {
-			close(ch)
-			l.waitList.Remove(w)
+	defer l.unlock()
+	if l.bypassBudget > 0 && l.bypassing >= l.bypassBudget {
+		return false
+	}
+	l.bypassing++
+	return true
+}
+
+// FinishBypass reports that a caller bypassed by WaitOrBypass is done.
+func (l *Limiter) FinishBypass() {
+	l.mu.Lock()
+	defer l.unlock()
+	if l.bypassing > 0 {
+		l.bypassing--
+	}
+}
+
+// BypassCount returns the number of bypassed callers in flight. Together with Count it is
+// the true load on the resource guarded by the limiter.
+func (l *Limiter) BypassCount() int {
+	l.mu.Lock()
+	defer l.unlock()
+	return l.bypassing
+}
+
+func (l *Limiter) removeWaiter(w *waiter) bool {
+	l.mu.Lock()
+	defer l.unlock()
+	if w.elem == nil {
+		return false
+	}
+	l.waitList.Remove(w.elem)
+	w.elem = nil
+	close(w.done)
+	l.updateSlow()
+	return true
+}
+
+// tryAcquire takes a slot without the mutex if one is free and nobody is waiting.
+func (l *Limiter) tryAcquire() bool {
+	for {
+		s := atomic.LoadInt64(&l.state)
+		if s&slow != 0 || s&countMask >= int64(l.limit) {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&l.state, s, s+1) {
 			return true
 		}
 	}
-	return false
+}
+
+// tryRelease releases a slot without the mutex if nobody is waiting. ok is false if the mutex
+// is needed , otherwise released reports whether a slot was acquired.
+func (l *Limiter) tryRelease() (released bool, ok bool) {
+	for {
+		s := atomic.LoadInt64(&l.state)
+		if s&slow != 0 {
+			return false, false
+		}
+		if s == 0 {
+			return false, true
+		}
+		if atomic.CompareAndSwapInt64(&l.state, s, s-1) {
+			return true, true
+		}
+	}
+}
+
+// contended reports whether the slow flag is set.
+func (l *Limiter) contended() bool {
+	return atomic.LoadInt64(&l.state)&slow != 0
+}
+
+// updateSlow sets the slow flag if goroutines are waiting or the limiter is paused or closed ,
+// and clears it otherwise. Callers must hold l.mu.
+func (l *Limiter) updateSlow() {
+	needed := l.closed || l.paused || l.waitList.Len() > 0
+	for {
+		s := atomic.LoadInt64(&l.state)
+		next := s &^ slow
+		if needed {
+			next |= slow
+		}
+		if next == s || atomic.CompareAndSwapInt64(&l.state, s, next) {
+			return
+		}
+	}
 }
 
 // proceed will return true if the number of concurrent requests is less than the limit else it
-// will add the goroutine to the waiting list and will return a channel. This channel is used by goutines to
-// check for signal when they are granted access to use the resource.
-func (l *Limiter) proceed() (bool, chan struct{}) {
+// will add the goroutine to the waiting list and will return a waiter. The waiter's channel is used by goutines to
+// check for signal when they are granted access to use the resource. position is the number of goroutines
+// already waiting. An error is returned when the limiter is closed or the waiting list is full.
+// async is attached to the waiter of a caller of AcquireAsync before it is visible to other goroutines.
+func (l *Limiter) proceed(async *asyncWait) (bool, *waiter, int, error) {
 	l.mu.Lock()
-	defer l.mu.Unlock()
+	defer l.unlock()
 
-	if l.count < l.limit {
-		l.count++
-		return true, nil
+	if l.closed {
+		return false, nil, 0, ErrClosed
+	}
+	position := l.waitList.Len()
+	for {
+		s := atomic.LoadInt64(&l.state)
+		if !l.paused && position == 0 && s&countMask < int64(l.limit) {
+			if atomic.CompareAndSwapInt64(&l.state, s, s+1) {
+				return true, nil, 0, nil
+			}
+			continue
+		}
+		if l.maxWaiting > 0 && position >= l.maxWaiting {
+			return false, nil, position, ErrRejected
+		}
+		// the flag must be set in the same step as the count is checked , otherwise a release
+		// on the fast path could free a slot which nobody hands to the new waiter.
+		if atomic.CompareAndSwapInt64(&l.state, s, s|slow) {
+			break
+		}
+	}
+	w := &waiter{
+		done:  make(chan struct{}),
+		async: async,
 	}
-	ch := make(chan struct{})
-	w := waiter{
-		done: ch,
+	if async != nil {
+		async.position = position
 	}
-	l.waitList.PushBack(w)
-	return false, ch
+	w.elem = l.waitList.PushBack(w)
+	return false, w, position, nil
 }
 
 // Finish will remove the goroutine from the waiting list and sends a signal
 // to the waiting goroutine to access the resource
 func (l *Limiter) Finish() {
+	l.forgetWait()
+	l.release()
+}
+
+// release frees a slot and reports whether one was acquired.
+func (l *Limiter) release() bool {
+	if released, ok := l.tryRelease(); ok {
+		return released
+	}
 	l.mu.Lock()
-	defer l.mu.Unlock()
-	if l.count == 0 {
-		return
+	defer l.unlock()
+	// the slow flag may have been cleared since tryRelease , so the count can still change.
+	var s int64
+	for {
+		s = atomic.LoadInt64(&l.state)
+		if s&countMask == 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&l.state, s, s-1) {
+			break
+		}
 	}
-	l.count -= 1
-	first := l.waitList.Front()
-	if first == nil {
-		return
+	if l.closed && (s-1)&countMask == 0 && l.idle != nil {
+		close(l.idle)
+		l.idle = nil
 	}
-	w := l.waitList.Remove(first).(waiter)
-	l.count++
-	close(w.done)
+	l.dispatch()
+	return true
+}
+
+// dispatch hands free capacity to the waiting goroutines in FIFO order. Callers must hold l.mu.
+func (l *Limiter) dispatch() {
+	// while goroutines are waiting the slow flag is set , so only the mutex holder changes the count.
+	for !l.paused && l.Count() < l.limit {
+		first := l.waitList.Front()
+		if first == nil {
+			break
+		}
+		w := l.waitList.Remove(first).(*waiter)
+		w.elem = nil
+		atomic.AddInt64(&l.state, 1)
+		l.signal(w)
+	}
+	l.updateSlow()
+}
+
+// Pause stops granting capacity. New callers are added to the waiting list and the waiting
+// callers keep waiting , subject to their timeouts and contexts , until Resume is called.
+func (l *Limiter) Pause() {
+	l.mu.Lock()
+	defer l.unlock()
+	l.paused = true
+	l.updateSlow()
+}
+
+// Resume grants capacity again and admits the waiting callers in FIFO order.
+func (l *Limiter) Resume() {
+	l.mu.Lock()
+	defer l.unlock()
+	l.paused = false
+	l.dispatch()
+}
+
+// Paused reports whether admission is paused.
+func (l *Limiter) Paused() bool {
+	l.mu.Lock()
+	defer l.unlock()
+	return l.paused
+}
+
+// Close fails all current and future waiters with ErrClosed. Goroutines which already acquired
+// capacity are not affected and should still call Finish.
+func (l *Limiter) Close() {
+	l.mu.Lock()
+	defer l.unlock()
+	l.closeLocked()
+}
+
+func (l *Limiter) closeLocked() {
+	l.closed = true
+	for e := l.waitList.Front(); e != nil; e = l.waitList.Front() {
+		w := l.waitList.Remove(e).(*waiter)
+		w.elem = nil
+		w.err = ErrClosed
+		l.signal(w)
+	}
+	l.updateSlow()
+}
+
+// Drain stops admitting new work like Close and blocks until every goroutine which acquired
+// capacity called Finish or the context is done , in which case the context error is returned.
+func (l *Limiter) Drain(ctx context.Context) error {
+	l.mu.Lock()
+	l.closeLocked()
+	if l.Count() == 0 {
+		l.unlock()
+		return nil
+	}
+	if l.idle == nil {
+		l.idle = make(chan struct{})
+	}
+	idle := l.idle
+	l.unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Acquire is like Wait but returns a permit which releases the capacity.
+// The permit is a lease when WithLeaseDuration is configured.
+func (l *Limiter) Acquire(ctx context.Context) (*Permit, error) {
+	if _, err := l.wait(ctx, false); err != nil {
+		return nil, err
+	}
+	return l.permit(l.acquisition()), nil
+}
+
+// permit wraps acquired capacity in a permit. a is recorded until the permit is released when
+// tracking is enabled.
+func (l *Limiter) permit(a Acquisition) *Permit {
+	var stack []byte
+	if l.leaseStacks {
+		stack = debug.Stack()
+	}
+	e := l.record(a)
+	release := func() {
+		l.forget(e)
+		l.release()
+	}
+	return NewPermit(l.clock, release, l.leaseDuration, stack, l.onLeaseExpire)
 }
 
 // Run wraps the function to limit the concurrency.....
+// The capacity is released even if the callback panics.
 func (l *Limiter) Run(ctx context.Context, callback func() error) error {
-	if err := l.Wait(ctx); err != nil {
+	permit, err := l.Acquire(ctx)
+	if err != nil {
 		return err
 	}
-	defer l.Finish()
+	defer permit.Release()
 	return callback()
 }
 
 // RunOrBypass executes the callback after real acquisition or bypass after timeout.
 // Finish is only called when capacity was actually acquired.
 func (l *Limiter) RunOrBypass(ctx context.Context, callback func() error) (AdmissionResult, error) {
-	result, err := l.WaitOrBypass(ctx)
+	result, err := l.wait(ctx, true)
 	if err != nil {
 		return 0, err
 	}
 	if result == AdmissionAcquired {
-		defer l.Finish()
+		defer l.permit(l.acquisition()).Release()
+	} else {
+		defer l.FinishBypass()
 	}
 	return result, callback()
 }
 
+// RunWithFallback executes primary when capacity was actually acquired. When the caller is not
+// admitted because the timeout expired , the waitlist is full or the deadline is unattainable ,
+// fallback is executed instead with the reason. The fallback doesn't use the guarded resource ,
+// so it takes no bypass budget and is not counted by BypassCount.
+// If the context is done or the limiter is closed before admission neither function is executed
+// and the error is returned.
+func (l *Limiter) RunWithFallback(ctx context.Context,
+	primary func() error,
+	fallback func(ctx context.Context, result AdmissionResult) error) error {
+	if _, err := l.wait(ctx, false); err != nil {
+		switch outcome := Outcome(err); outcome {
+		case 0, AdmissionCanceled, AdmissionClosed:
+			return err
+		default:
+			return fallback(ctx, outcome)
+		}
+	}
+	defer l.permit(l.acquisition()).Release()
+	return primary()
+}
+
 // only used in tests
 func (l *Limiter) waitListSize() int {
 	l.mu.Lock()
-	defer l.mu.Unlock()
+	defer l.unlock()
 	len := l.waitList.Len()
 	return len
 }
 
+// Waiting returns the number of goroutines in the waitlist.
+func (l *Limiter) Waiting() int {
+	return l.waitListSize()
+}
+
 // Count returns the current number of concurrent gouroutines executing...
 func (l *Limiter) Count() int {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	return l.count
+	return int(atomic.LoadInt64(&l.state) & countMask)
 }
@@ -315,3 +315,245 @@ func TestDeprecatedWithTimeoutStillUsesMilliseconds(t *testing.T) {
 	l.Finish()
 	assert.Zero(t, l.Count())
 }
+
+func TestWaitReturnsAdmissionErrorOnTimeout(t *testing.T) {
+	l := New(1, WithTimeoutDuration(20*time.Millisecond))
+	assert.NoError(t, l.Wait(context.Background()))
+
+	err := l.Wait(context.Background())
+
+	var ae *AdmissionError
+	assert.True(t, errors.As(err, &ae))
+	assert.True(t, errors.Is(err, ErrTimeout))
+	assert.Equal(t, AdmissionTimedOut, ae.Result)
+	assert.Equal(t, AdmissionTimedOut, Outcome(err))
+	assert.Zero(t, ae.Position)
+	assert.GreaterOrEqual(t, int64(ae.Waited), int64(20*time.Millisecond))
+
+	l.Finish()
+	assert.Zero(t, l.Count())
+}
+
+func TestWaitRejectsWhenWaitListIsFull(t *testing.T) {
+	l := New(1, WithMaxWaiting(1))
+	assert.NoError(t, l.Wait(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Wait(ctx)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	err := l.Wait(context.Background())
+	assert.True(t, errors.Is(err, ErrRejected))
+	assert.Equal(t, AdmissionRejected, Outcome(err))
+	assert.Equal(t, 1, err.(*AdmissionError).Position)
+
+	cancel()
+	err = <-done
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, AdmissionCanceled, Outcome(err))
+
+	l.Finish()
+	assert.Zero(t, l.Count())
+}
+
+func TestAdmissionResultString(t *testing.T) {
+	assert.Equal(t, "acquired", AdmissionAcquired.String())
+	assert.Equal(t, "shed", AdmissionShed.String())
+	assert.Equal(t, "AdmissionResult(0)", AdmissionResult(0).String())
+	assert.Zero(t, Outcome(errors.New("other")))
+}
+
+func TestRunWithFallback(t *testing.T) {
+	l := New(1, WithTimeoutDuration(20*time.Millisecond), WithBypassBudget(1))
+
+	primary := func() error { return nil }
+	var reasons []AdmissionResult
+	fallback := func(ctx context.Context, result AdmissionResult) error {
+		reasons = append(reasons, result)
+		return errors.New("served from cache")
+	}
+
+	assert.NoError(t, l.RunWithFallback(context.Background(), primary, fallback))
+	assert.Zero(t, l.Count())
+	assert.Empty(t, reasons)
+
+	assert.NoError(t, l.Wait(context.Background()))
+	err := l.RunWithFallback(context.Background(), func() error {
+		t.Fatal("primary must not run without capacity")
+		return nil
+	}, fallback)
+	assert.EqualError(t, err, "served from cache")
+	assert.Equal(t, []AdmissionResult{AdmissionTimedOut}, reasons)
+	assert.Zero(t, l.BypassCount())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = l.RunWithFallback(ctx, primary, fallback)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Len(t, reasons, 1)
+
+	l.Finish()
+	assert.Zero(t, l.Count())
+}
+
+func TestRunWithFallbackOnRejection(t *testing.T) {
+	l := New(1, WithMaxWaiting(1))
+	assert.NoError(t, l.Wait(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Wait(ctx)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	var reason AdmissionResult
+	err := l.RunWithFallback(context.Background(), func() error {
+		t.Fatal("primary must not run without capacity")
+		return nil
+	}, func(ctx context.Context, result AdmissionResult) error {
+		reason = result
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, AdmissionRejected, reason)
+
+	cancel()
+	assert.True(t, errors.Is(<-done, context.Canceled))
+	l.Finish()
+	assert.Zero(t, l.Count())
+}
+
+func TestBypassBudgetLimitsBypassedCallers(t *testing.T) {
+	l := New(1, WithTimeoutDuration(20*time.Millisecond), WithBypassBudget(1))
+	assert.NoError(t, l.Wait(context.Background()))
+
+	result, err := l.WaitOrBypass(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, AdmissionBypassed, result)
+	assert.Equal(t, 1, l.BypassCount())
+
+	result, err = l.WaitOrBypass(context.Background())
+	assert.Zero(t, result)
+	assert.True(t, errors.Is(err, ErrTimeout))
+
+	l.FinishBypass()
+	assert.Zero(t, l.BypassCount())
+
+	result, err = l.RunOrBypass(context.Background(), func() error {
+		assert.Equal(t, 1, l.BypassCount())
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, AdmissionBypassed, result)
+	assert.Zero(t, l.BypassCount())
+
+	l.Finish()
+	assert.Zero(t, l.Count())
+}
+
+func TestCloseFailsCurrentAndFutureWaiters(t *testing.T) {
+	l := New(1)
+	assert.NoError(t, l.Wait(context.Background()))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Wait(context.Background())
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	l.Close()
+	err := <-done
+	assert.True(t, errors.Is(err, ErrClosed))
+	assert.Equal(t, AdmissionClosed, Outcome(err))
+	assert.Zero(t, l.waitListSize())
+
+	l.Finish()
+	assert.True(t, errors.Is(l.Wait(context.Background()), ErrClosed))
+	assert.Zero(t, l.Count())
+}
+
+func TestDrainWaitsForInFlightWork(t *testing.T) {
+	l := New(2)
+	assert.NoError(t, l.Wait(context.Background()))
+	assert.NoError(t, l.Wait(context.Background()))
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- l.Drain(context.Background())
+	}()
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, errors.Is(l.Wait(context.Background()), ErrClosed))
+
+	l.Finish()
+	select {
+	case <-drained:
+		t.Fatal("drain returned before the in-flight work finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	l.Finish()
+	assert.NoError(t, <-drained)
+	assert.NoError(t, l.Drain(context.Background()))
+}
+
+func TestDrainReturnsContextError(t *testing.T) {
+	l := New(1)
+	assert.NoError(t, l.Wait(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.True(t, errors.Is(l.Drain(ctx), context.DeadlineExceeded))
+
+	l.Finish()
+	assert.Zero(t, l.Count())
+}
+
+func TestPauseAndResume(t *testing.T) {
+	l := New(1)
+	assert.NoError(t, l.Wait(context.Background()))
+	l.Pause()
+	assert.True(t, l.Paused())
+
+	var wg sync.WaitGroup
+	order := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			assert.NoError(t, l.Run(context.Background(), func() error {
+				order <- index
+				return nil
+			}))
+		}(i)
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// the released slot is not granted while paused.
+	l.Finish()
+	assert.Equal(t, 2, l.waitListSize())
+	assert.Zero(t, l.Count())
+
+	l.Resume()
+	assert.False(t, l.Paused())
+	wg.Wait()
+	close(order)
+	var got []int
+	for index := range order {
+		got = append(got, index)
+	}
+	assert.Equal(t, []int{0, 1}, got)
+	assert.Zero(t, l.Count())
+}
+
+func TestPausedWaiterStillTimesOut(t *testing.T) {
+	l := New(1, WithTimeoutDuration(20*time.Millisecond))
+	l.Pause()
+
+	assert.True(t, errors.Is(l.Wait(context.Background()), ErrTimeout))
+	assert.Zero(t, l.waitListSize())
+	assert.Zero(t, l.Count())
+}
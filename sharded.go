@@ -0,0 +1,206 @@
+package limiter
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ShardedLimiter splits the limit across several Limiters , so goroutines on different CPUs
+// rarely touch the same mutex or cache line. It provides the same Wait , Finish and Run methods
+// as Limiter.
+//
+// Every goroutine has a home shard. Wait takes a free slot of the home shard , or steals a free
+// slot of another shard , and only waits on the home shard when no shard has spare capacity.
+//
+// Fairness is approximate:
+//   - goroutines waiting on the same shard are admitted in FIFO order ,
+//   - a released slot is handed to a waiting goroutine if any shard has one , so new callers can't
+//     take capacity away from goroutines which are already waiting ,
+//   - shards with waiting goroutines are served in rotation , so a goroutine at position p of its
+//     shard's waitlist is admitted within (p+1)*Shards releases.
+//
+// Goroutines waiting on different shards are not ordered , a goroutine may be admitted before
+// one which started waiting earlier on another shard.
+type ShardedLimiter struct {
+	shards []*Limiter
+	// homes hands out home shard indexes. sync.Pool keeps them per P , so goroutines running on
+	// the same P tend to use the same shard.
+	homes    sync.Pool
+	next     uint32
+	rotation uint32
+}
+
+// NewSharded creates a limiter of limit slots split across shards Limiters , shards defaults to
+// GOMAXPROCS when it is not positive and is at most limit. The options are applied to every shard ,
+// so e.g. WithMaxWaiting limits the waitlist of each shard.
+func NewSharded(limit int, shards int, options ...Option) *ShardedLimiter {
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+	if shards > limit {
+		shards = limit
+	}
+	if shards < 1 {
+		shards = 1
+	}
+	s := &ShardedLimiter{
+		shards: make([]*Limiter, shards),
+	}
+	for i := range s.shards {
+		n := limit / shards
+		if i < limit%shards {
+			n++
+		}
+		s.shards[i] = New(n, options...)
+	}
+	s.homes.New = func() interface{} {
+		home := int((atomic.AddUint32(&s.next, 1) - 1) % uint32(len(s.shards)))
+		return &home
+	}
+	return s
+}
+
+// home returns the home shard of the calling goroutine.
+func (s *ShardedLimiter) home() int {
+	h := s.homes.Get().(*int)
+	home := *h
+	s.homes.Put(h)
+	return home
+}
+
+// Wait waits until capacity is available or the context/timeout expires.
+func (s *ShardedLimiter) Wait(ctx context.Context) error {
+	home := s.home()
+	if s.steal(home, -1) >= 0 {
+		return nil
+	}
+	return s.waitHome(ctx, home)
+}
+
+// steal takes a free slot of any shard but skip , starting with the home shard. It returns the
+// index of the shard or -1 if no shard has a free slot.
+func (s *ShardedLimiter) steal(home, skip int) int {
+	n := len(s.shards)
+	for i := 0; i < n; i++ {
+		shard := (home + i) % n
+		if shard != skip && s.shards[shard].tryAcquire() {
+			return shard
+		}
+	}
+	return -1
+}
+
+// waitHome queues the caller on its home shard. A slot released on the fast path of another shard
+// after steal looked at it is not handed to anybody , so the other shards are checked again once
+// the waiter is queued. From then on the home shard is contended and Finish serves it.
+func (s *ShardedLimiter) waitHome(ctx context.Context, home int) error {
+	sh := s.shards[home]
+	start := sh.clock.Now()
+	ok, w, position, err := sh.proceed(nil)
+	if ok {
+		return nil
+	}
+	if err != nil {
+		return sh.enqueueError(err, start, position)
+	}
+	if stolen := s.steal(home, home); stolen >= 0 {
+		if sh.removeWaiter(w) {
+			return nil
+		}
+		// the waiter was admitted or closed meanwhile , the stolen slot is not needed.
+		s.shards[stolen].release()
+		_, err := sh.admitted(w, start, position)
+		return err
+	}
+	_, err = sh.await(ctx, w, start, position, false)
+	return err
+}
+
+// Finish releases capacity acquired by Wait and hands it to a waiting goroutine if there is one.
+func (s *ShardedLimiter) Finish() {
+	if s.contended() && s.handOff() {
+		return
+	}
+	n := len(s.shards)
+	home := s.home()
+	for i := 0; i < n; i++ {
+		shard := (home + i) % n
+		if s.shards[shard].release() {
+			s.rehome(shard)
+			return
+		}
+	}
+}
+
+// handOff releases a slot of a contended shard , in rotation , so that its waiting goroutine is
+// admitted. It returns false if no contended shard holds a slot.
+func (s *ShardedLimiter) handOff() bool {
+	n := len(s.shards)
+	start := int(atomic.AddUint32(&s.rotation, 1) % uint32(n))
+	for i := 0; i < n; i++ {
+		sh := s.shards[(start+i)%n]
+		if sh.contended() && sh.release() {
+			return true
+		}
+	}
+	return false
+}
+
+// rehome moves a slot just released on the given shard to a goroutine waiting on another shard.
+// The goroutine may have queued after Finish checked for contention , having seen the shard full ,
+// and nothing else would admit it while the slot sits unused on the shard.
+func (s *ShardedLimiter) rehome(shard int) {
+	sh := s.shards[shard]
+	if !s.contended() || !sh.tryAcquire() {
+		return
+	}
+	if !s.handOff() {
+		// the waiters left meanwhile , give the slot back.
+		sh.release()
+	}
+}
+
+// contended reports whether goroutines are waiting on any shard.
+func (s *ShardedLimiter) contended() bool {
+	for _, sh := range s.shards {
+		if sh.contended() {
+			return true
+		}
+	}
+	return false
+}
+
+// Run wraps the function to limit the concurrency.
+// The capacity is released even if the callback panics.
+func (s *ShardedLimiter) Run(ctx context.Context, callback func() error) error {
+	if err := s.Wait(ctx); err != nil {
+		return err
+	}
+	defer s.Finish()
+	return callback()
+}
+
+// Count returns the current number of concurrent goroutines executing.
+func (s *ShardedLimiter) Count() int {
+	count := 0
+	for _, sh := range s.shards {
+		count += sh.Count()
+	}
+	return count
+}
+
+// Waiting returns the number of goroutines waiting on any shard.
+func (s *ShardedLimiter) Waiting() int {
+	waiting := 0
+	for _, sh := range s.shards {
+		waiting += sh.Waiting()
+	}
+	return waiting
+}
+
+// Shards returns the number of shards.
+func (s *ShardedLimiter) Shards() int {
+	return len(s.shards)
+}
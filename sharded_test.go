@@ -0,0 +1,173 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedSplitsLimit(t *testing.T) {
+	s := NewSharded(10, 4)
+	assert.Equal(t, 4, s.Shards())
+	limits := make([]int, 0, 4)
+	for _, sh := range s.shards {
+		limits = append(limits, sh.limit)
+	}
+	assert.Equal(t, []int{3, 3, 2, 2}, limits)
+	assert.Equal(t, 2, NewSharded(2, 8).Shards())
+}
+
+func TestShardedStealsSpareCapacity(t *testing.T) {
+	s := NewSharded(4, 4)
+	ctx := context.Background()
+	// a single goroutine has a single home shard , the other slots are stolen.
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, s.Wait(ctx))
+	}
+	assert.Equal(t, 4, s.Count())
+	for _, sh := range s.shards {
+		assert.Equal(t, 1, sh.Count())
+	}
+	for i := 0; i < 4; i++ {
+		s.Finish()
+	}
+	assert.Equal(t, 0, s.Count())
+}
+
+func TestShardedServesWaitingShardsInRotation(t *testing.T) {
+	s := NewSharded(4, 4)
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, s.Wait(ctx))
+	}
+
+	// three goroutines wait on shard 0 and one on shard 2.
+	admitted := make(chan int, 4)
+	enqueue := func(shard, id int) {
+		go func() {
+			_ = s.shards[shard].Wait(ctx)
+			admitted <- id
+		}()
+		for s.shards[shard].Waiting() == 0 || (shard == 0 && s.shards[0].Waiting() < id+1) {
+			runtime.Gosched()
+		}
+	}
+	enqueue(0, 0)
+	enqueue(0, 1)
+	enqueue(0, 2)
+	enqueue(2, 3)
+
+	// within one rotation both contended shards are served , the goroutine at position 0
+	// of shard 0 and the goroutine of shard 2.
+	for i := 0; i < 4 && s.Waiting() > 2; i++ {
+		s.Finish()
+	}
+	first := []int{<-admitted, <-admitted}
+	assert.ElementsMatch(t, []int{0, 3}, first)
+	// waiters of the same shard are admitted in FIFO order.
+	s.Finish()
+	assert.Equal(t, 1, <-admitted)
+	s.Finish()
+	assert.Equal(t, 2, <-admitted)
+	assert.Equal(t, 4, s.Count())
+}
+
+func TestShardedStress(t *testing.T) {
+	const limit = 8
+	s := NewSharded(limit, 4)
+	var inFlight, maxInFlight int64
+	var wg sync.WaitGroup
+	for g := 0; g < 64; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 300; i++ {
+				_ = s.Run(context.Background(), func() error {
+					n := atomic.AddInt64(&inFlight, 1)
+					for {
+						m := atomic.LoadInt64(&maxInFlight)
+						if n <= m || atomic.CompareAndSwapInt64(&maxInFlight, m, n) {
+							break
+						}
+					}
+					runtime.Gosched()
+					atomic.AddInt64(&inFlight, -1)
+					return nil
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, maxInFlight, int64(limit))
+	assert.Equal(t, 0, s.Count())
+	assert.Equal(t, 0, s.Waiting())
+}
+
+func BenchmarkShardedWaitFinishContended(b *testing.B) {
+	for _, n := range procs {
+		b.Run(fmt.Sprintf("procs=%d", n), func(b *testing.B) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(n))
+			s := NewSharded((n+1)/2, 0)
+			ctx := context.Background()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_ = s.Wait(ctx)
+					s.Finish()
+				}
+			})
+		})
+	}
+}
+
+func TestShardedFinishHandsFastPathReleaseToWaiter(t *testing.T) {
+	s := NewSharded(2, 2)
+	assert.True(t, s.shards[0].tryAcquire())
+	assert.True(t, s.shards[1].tryAcquire())
+
+	// Finish saw no contention , then a waiter found shard 1 full and queued on shard 0.
+	done := make(chan error, 1)
+	go func() {
+		done <- s.waitHome(context.Background(), 0)
+	}()
+	for s.Waiting() == 0 {
+		runtime.Gosched()
+	}
+
+	// Finish frees the slot of shard 1 on the fast path.
+	released, ok := s.shards[1].tryRelease()
+	assert.True(t, released && ok)
+	s.rehome(1)
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the waiter was not admitted")
+	}
+	assert.Equal(t, 2, s.Count())
+	assert.Equal(t, 0, s.Waiting())
+}
+
+func TestShardedWaiterGetsSlotReleasedBeforeItQueued(t *testing.T) {
+	s := NewSharded(2, 2)
+	assert.True(t, s.shards[0].tryAcquire())
+	assert.True(t, s.shards[1].tryAcquire())
+	assert.Equal(t, -1, s.steal(0, -1))
+
+	// a slot of shard 1 is released on the fast path after the waiter looked at it , but before
+	// the waiter is queued on its home shard.
+	assert.True(t, s.shards[1].release())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, s.waitHome(ctx, 0))
+	assert.Equal(t, 1, s.shards[1].Count())
+	assert.Equal(t, 0, s.shards[0].Waiting())
+	assert.Equal(t, 2, s.Count())
+}
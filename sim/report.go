@@ -0,0 +1,71 @@
+package sim
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+var columns = []string{"priority", "requests", "acquired", "bypass_rate", "timeout_rate", "wait_p50", "wait_p90", "wait_p99", "wait_max"}
+
+// WriteTable writes the result as an aligned table.
+func WriteTable(w io.Writer, r Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, c := range columns {
+		fmt.Fprintf(tw, "%s\t", c)
+	}
+	fmt.Fprintln(tw)
+	for _, c := range r.Classes {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%.2f%%\t%.2f%%\t%v\t%v\t%v\t%v\t\n",
+			c.Priority, c.Requests, c.Acquired, 100*c.BypassRate(), 100*c.TimeoutRate(),
+			round(c.Wait50), round(c.Wait90), round(c.Wait99), round(c.WaitMax))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\nutilisation %.2f%% over %v\n", 100*r.Utilisation, round(r.Elapsed))
+	return err
+}
+
+// WriteCSV writes one row per class , durations are in milliseconds. The utilisation of the
+// limiter is repeated on every row.
+func WriteCSV(w io.Writer, r Result) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append(append([]string(nil), columns...), "utilisation")); err != nil {
+		return err
+	}
+	for _, c := range r.Classes {
+		row := []string{
+			strconv.Itoa(int(c.Priority)),
+			strconv.Itoa(c.Requests),
+			strconv.Itoa(c.Acquired),
+			formatFloat(c.BypassRate()),
+			formatFloat(c.TimeoutRate()),
+			milliseconds(c.Wait50),
+			milliseconds(c.Wait90),
+			milliseconds(c.Wait99),
+			milliseconds(c.WaitMax),
+			formatFloat(r.Utilisation),
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
+
+func milliseconds(d time.Duration) string {
+	return formatFloat(float64(d) / float64(time.Millisecond))
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 4, 64)
+}
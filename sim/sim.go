@@ -0,0 +1,388 @@
+// Package sim simulates a limiter under a synthetic workload on a virtual clock , so the effect of
+// a limit , timeout or aging period on latency and starvation can be seen before it is rolled out.
+//
+// The simulation drives a real limiter.Limiter or priority.PriorityLimiter. Every request runs in
+// its own goroutine and the virtual clock only advances once all of them are waiting for capacity
+// or holding it.
+package sim
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	limiter "github.com/vivek-ng/concurrency-limiter"
+	"github.com/vivek-ng/concurrency-limiter/internal/fakeclock"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+)
+
+// Distribution samples service times.
+type Distribution interface {
+	Sample(r *rand.Rand) time.Duration
+}
+
+// Constant is a distribution which always returns the same duration.
+type Constant time.Duration
+
+// Sample returns the duration.
+func (c Constant) Sample(*rand.Rand) time.Duration {
+	return time.Duration(c)
+}
+
+// Exponential is an exponential distribution with the given mean.
+type Exponential time.Duration
+
+// Sample returns a random duration.
+func (e Exponential) Sample(r *rand.Rand) time.Duration {
+	return time.Duration(r.ExpFloat64() * float64(e))
+}
+
+// Uniform is a uniform distribution between Min and Max.
+type Uniform struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// Sample returns a random duration.
+func (u Uniform) Sample(r *rand.Rand) time.Duration {
+	if u.Max <= u.Min {
+		return u.Min
+	}
+	return u.Min + time.Duration(r.Int63n(int64(u.Max-u.Min)))
+}
+
+// Class is a stream of requests with the same priority.
+type Class struct {
+	// Priority is ignored when the simulation drives a limiter.Limiter.
+	Priority priority.PriorityValue
+	// Rate is the mean number of arrivals per second , arrivals follow a Poisson process.
+	Rate float64
+	// Service is how long a request holds the capacity.
+	Service Distribution
+}
+
+// Config describes the limiter and the workload.
+type Config struct {
+	Limit int
+	// Priority drives a priority.PriorityLimiter instead of a limiter.Limiter.
+	Priority bool
+	// Timeout configures WithTimeoutDuration when positive.
+	Timeout time.Duration
+	// DynamicPeriod configures WithDynamicPriorityDuration when positive , it requires Priority.
+	DynamicPeriod time.Duration
+	// Bypass uses WaitOrBypass , bypassed requests still run for their service time.
+	Bypass       bool
+	BypassBudget int
+	Classes      []Class
+	// Duration is how long requests arrive , the simulation runs until all of them completed.
+	Duration time.Duration
+	// Seed makes the workload reproducible.
+	Seed int64
+}
+
+// Result is the outcome of a simulation.
+type Result struct {
+	// Elapsed is the virtual time until the last request completed.
+	Elapsed time.Duration
+	// Utilisation is the average fraction of the limit which was acquired.
+	Utilisation float64
+	// Classes are the results of each class of the configuration , in the same order.
+	Classes []ClassResult
+}
+
+// ClassResult describes the requests of one class. Wait percentiles only include acquired requests.
+type ClassResult struct {
+	Priority priority.PriorityValue
+	Requests int
+	Acquired int
+	Bypassed int
+	TimedOut int
+	Wait50   time.Duration
+	Wait90   time.Duration
+	Wait99   time.Duration
+	WaitMax  time.Duration
+}
+
+// BypassRate returns the fraction of the requests which were bypassed.
+func (c ClassResult) BypassRate() float64 {
+	return rate(c.Bypassed, c.Requests)
+}
+
+// TimeoutRate returns the fraction of the requests which timed out.
+func (c ClassResult) TimeoutRate() float64 {
+	return rate(c.TimedOut, c.Requests)
+}
+
+func rate(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+// ErrInvalidConfig is returned by Run when the configuration can't be simulated.
+var ErrInvalidConfig = errors.New("sim: invalid config")
+
+// start is the virtual time at which every simulation starts.
+var start = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Run simulates the configuration and returns the result. With dynamic priority the waiters age in
+// their own goroutines , so results of the same seed may vary slightly between runs.
+func Run(cfg Config) (Result, error) {
+	if err := cfg.validate(); err != nil {
+		return Result{}, err
+	}
+	s := newSimulation(cfg)
+	return s.run(), nil
+}
+
+func (cfg Config) validate() error {
+	if cfg.Limit <= 0 || cfg.Duration <= 0 || len(cfg.Classes) == 0 {
+		return ErrInvalidConfig
+	}
+	if cfg.DynamicPeriod > 0 && !cfg.Priority {
+		return ErrInvalidConfig
+	}
+	for _, c := range cfg.Classes {
+		if c.Rate <= 0 || c.Service == nil {
+			return ErrInvalidConfig
+		}
+	}
+	return nil
+}
+
+// target is the limiter driven by the simulation.
+type target interface {
+	wait(ctx context.Context, priority priority.PriorityValue) (limiter.AdmissionResult, error)
+	finish(priority priority.PriorityValue)
+	finishBypass()
+	count() int
+	waiting() int
+}
+
+type plainTarget struct {
+	l      *limiter.Limiter
+	bypass bool
+}
+
+func (t plainTarget) wait(ctx context.Context, _ priority.PriorityValue) (limiter.AdmissionResult, error) {
+	if t.bypass {
+		return t.l.WaitOrBypass(ctx)
+	}
+	return limiter.AdmissionAcquired, t.l.Wait(ctx)
+}
+
+func (t plainTarget) finish(priority.PriorityValue) { t.l.Finish() }
+func (t plainTarget) finishBypass()                 { t.l.FinishBypass() }
+func (t plainTarget) count() int                    { return t.l.Count() }
+func (t plainTarget) waiting() int                  { return t.l.Waiting() }
+
+type priorityTarget struct {
+	p      *priority.PriorityLimiter
+	bypass bool
+}
+
+func (t priorityTarget) wait(ctx context.Context, pr priority.PriorityValue) (limiter.AdmissionResult, error) {
+	if t.bypass {
+		return t.p.WaitOrBypass(ctx, pr)
+	}
+	return limiter.AdmissionAcquired, t.p.Wait(ctx, pr)
+}
+
+func (t priorityTarget) finish(pr priority.PriorityValue) { t.p.FinishPriority(pr) }
+func (t priorityTarget) finishBypass()                    { t.p.FinishBypass() }
+func (t priorityTarget) count() int                       { return t.p.Count() }
+func (t priorityTarget) waiting() int                     { return t.p.Stats().Waiting }
+
+type simulation struct {
+	cfg    Config
+	clock  *fakeclock.Clock
+	target target
+	rand   *rand.Rand
+	// timersPerWaiter is the number of timers and tickers a goroutine in the waitlist holds.
+	timersPerWaiter int
+
+	mu sync.Mutex
+	// arrivals is the number of classes which still have a pending arrival.
+	arrivals int
+	// running is the number of goroutines which are waiting or about to hold capacity.
+	running int
+	// holding is the number of requests which acquired or bypassed the limiter and did not complete.
+	holding int
+	waits   [][]time.Duration
+	results []ClassResult
+
+	busy time.Duration
+}
+
+func newSimulation(cfg Config) *simulation {
+	s := &simulation{
+		cfg:     cfg,
+		clock:   fakeclock.New(start),
+		rand:    rand.New(rand.NewSource(cfg.Seed)),
+		waits:   make([][]time.Duration, len(cfg.Classes)),
+		results: make([]ClassResult, len(cfg.Classes)),
+	}
+	if cfg.Timeout > 0 {
+		s.timersPerWaiter++
+	}
+	if cfg.DynamicPeriod > 0 {
+		s.timersPerWaiter++
+	}
+	if cfg.Priority {
+		options := []priority.Option{priority.WithClock(s.clock)}
+		if cfg.Timeout > 0 {
+			options = append(options, priority.WithTimeoutDuration(cfg.Timeout))
+		}
+		if cfg.DynamicPeriod > 0 {
+			options = append(options, priority.WithDynamicPriorityDuration(cfg.DynamicPeriod))
+		}
+		if cfg.BypassBudget > 0 {
+			options = append(options, priority.WithBypassBudget(cfg.BypassBudget))
+		}
+		s.target = priorityTarget{p: priority.NewLimiter(cfg.Limit, options...), bypass: cfg.Bypass}
+	} else {
+		options := []limiter.Option{limiter.WithClock(s.clock)}
+		if cfg.Timeout > 0 {
+			options = append(options, limiter.WithTimeoutDuration(cfg.Timeout))
+		}
+		if cfg.BypassBudget > 0 {
+			options = append(options, limiter.WithBypassBudget(cfg.BypassBudget))
+		}
+		s.target = plainTarget{l: limiter.New(cfg.Limit, options...), bypass: cfg.Bypass}
+	}
+	for i, c := range cfg.Classes {
+		s.results[i].Priority = c.Priority
+	}
+	return s
+}
+
+func (s *simulation) run() Result {
+	s.arrivals = len(s.cfg.Classes)
+	for i := range s.cfg.Classes {
+		s.scheduleArrival(i)
+	}
+	for {
+		s.settle()
+		next, ok := s.clock.Next()
+		if !ok {
+			break
+		}
+		s.busy += time.Duration(s.target.count()) * next.Sub(s.clock.Now())
+		s.clock.Advance(next.Sub(s.clock.Now()))
+	}
+
+	elapsed := s.clock.Now().Sub(start)
+	result := Result{
+		Elapsed: elapsed,
+		Classes: s.results,
+	}
+	if elapsed > 0 {
+		result.Utilisation = float64(s.busy) / float64(elapsed) / float64(s.cfg.Limit)
+	}
+	for i := range result.Classes {
+		waits := s.waits[i]
+		sort.Slice(waits, func(a, b int) bool { return waits[a] < waits[b] })
+		result.Classes[i].Wait50 = percentile(waits, 0.5)
+		result.Classes[i].Wait90 = percentile(waits, 0.9)
+		result.Classes[i].Wait99 = percentile(waits, 0.99)
+		result.Classes[i].WaitMax = percentile(waits, 1)
+	}
+	return result
+}
+
+// scheduleArrival schedules the next arrival of the class , or stops the class once the
+// arrivals are over.
+func (s *simulation) scheduleArrival(class int) {
+	c := s.cfg.Classes[class]
+	gap := time.Duration(s.rand.ExpFloat64() / c.Rate * float64(time.Second))
+	if s.clock.Now().Add(gap).Sub(start) >= s.cfg.Duration {
+		s.mu.Lock()
+		s.arrivals--
+		s.mu.Unlock()
+		return
+	}
+	s.clock.AfterFunc(gap, func() {
+		s.arrive(class)
+		s.scheduleArrival(class)
+	})
+}
+
+// arrive starts a request of the class. It is called by the clock , so the service time is sampled
+// in the same order for every run of a seed.
+func (s *simulation) arrive(class int) {
+	c := s.cfg.Classes[class]
+	service := c.Service.Sample(s.rand)
+	s.mu.Lock()
+	s.running++
+	s.results[class].Requests++
+	s.mu.Unlock()
+
+	go func() {
+		arrived := s.clock.Now()
+		result, err := s.target.wait(context.Background(), c.Priority)
+		waited := s.clock.Now().Sub(arrived)
+		if err == nil {
+			s.clock.AfterFunc(service, func() {
+				if result == limiter.AdmissionBypassed {
+					s.target.finishBypass()
+				} else {
+					s.target.finish(c.Priority)
+				}
+				s.mu.Lock()
+				s.holding--
+				s.mu.Unlock()
+			})
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.running--
+		switch {
+		case err != nil:
+			s.results[class].TimedOut++
+		case result == limiter.AdmissionBypassed:
+			s.holding++
+			s.results[class].Bypassed++
+		default:
+			s.holding++
+			s.results[class].Acquired++
+			s.waits[class] = append(s.waits[class], waited)
+		}
+	}()
+}
+
+// settle waits until every running goroutine is in the waitlist with its timers created and has
+// received its ticks.
+func (s *simulation) settle() {
+	for !s.quiescent() {
+		runtime.Gosched()
+	}
+}
+
+func (s *simulation) quiescent() bool {
+	s.mu.Lock()
+	arrivals, running, holding := s.arrivals, s.running, s.holding
+	s.mu.Unlock()
+	if s.target.waiting() != running {
+		return false
+	}
+	return s.clock.Timers() == arrivals+holding+running*s.timersPerWaiter && s.clock.Undelivered() == 0
+}
+
+// percentile returns the nearest rank percentile of the sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
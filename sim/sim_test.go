@@ -0,0 +1,127 @@
+package sim
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vivek-ng/concurrency-limiter/priority"
+)
+
+func TestRun_Deterministic(t *testing.T) {
+	cfg := Config{
+		Limit:   2,
+		Timeout: 20 * time.Millisecond,
+		Classes: []Class{
+			{Rate: 200, Service: Exponential(8 * time.Millisecond)},
+		},
+		Duration: time.Second,
+		Seed:     1,
+	}
+	first, err := Run(cfg)
+	assert.NoError(t, err)
+	second, err := Run(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+
+	c := first.Classes[0]
+	assert.Equal(t, c.Requests, c.Acquired+c.TimedOut)
+	assert.Greater(t, c.TimedOut, 0)
+	assert.True(t, c.WaitMax <= 20*time.Millisecond)
+	assert.True(t, c.Wait50 <= c.Wait90 && c.Wait90 <= c.Wait99 && c.Wait99 <= c.WaitMax)
+	assert.Greater(t, first.Utilisation, 0.5)
+	assert.LessOrEqual(t, first.Utilisation, 1.0)
+}
+
+func TestRun_NoContention(t *testing.T) {
+	result, err := Run(Config{
+		Limit: 100,
+		Classes: []Class{
+			{Rate: 10, Service: Constant(time.Millisecond)},
+		},
+		Duration: time.Second,
+		Seed:     1,
+	})
+	assert.NoError(t, err)
+	c := result.Classes[0]
+	assert.Equal(t, c.Requests, c.Acquired)
+	assert.Zero(t, c.WaitMax)
+	assert.Equal(t, 0.0, c.TimeoutRate())
+}
+
+func TestRun_PriorityStarvation(t *testing.T) {
+	result, err := Run(Config{
+		Limit:    1,
+		Priority: true,
+		Bypass:   true,
+		Timeout:  50 * time.Millisecond,
+		Classes: []Class{
+			{Priority: priority.Low, Rate: 50, Service: Constant(5 * time.Millisecond)},
+			{Priority: priority.High, Rate: 150, Service: Constant(5 * time.Millisecond)},
+		},
+		Duration: time.Second,
+		Seed:     7,
+	})
+	assert.NoError(t, err)
+	low, high := result.Classes[0], result.Classes[1]
+	assert.Equal(t, priority.Low, low.Priority)
+	assert.True(t, low.Wait90 > high.Wait90)
+	assert.Greater(t, low.BypassRate(), high.BypassRate())
+	assert.Equal(t, 0, low.TimedOut+high.TimedOut)
+}
+
+func TestRun_Aging(t *testing.T) {
+	result, err := Run(Config{
+		Limit:         1,
+		Priority:      true,
+		DynamicPeriod: 5 * time.Millisecond,
+		Classes: []Class{
+			{Priority: priority.Low, Rate: 50, Service: Constant(5 * time.Millisecond)},
+			{Priority: priority.High, Rate: 100, Service: Constant(5 * time.Millisecond)},
+		},
+		Duration: 500 * time.Millisecond,
+		Seed:     3,
+	})
+	assert.NoError(t, err)
+	for _, c := range result.Classes {
+		assert.Equal(t, c.Requests, c.Acquired)
+	}
+}
+
+func TestRun_InvalidConfig(t *testing.T) {
+	_, err := Run(Config{Limit: 1, Duration: time.Second})
+	assert.Equal(t, ErrInvalidConfig, err)
+	_, err = Run(Config{
+		Limit:         1,
+		DynamicPeriod: time.Millisecond,
+		Classes:       []Class{{Rate: 1, Service: Constant(time.Millisecond)}},
+		Duration:      time.Second,
+	})
+	assert.Equal(t, ErrInvalidConfig, err)
+}
+
+func TestWriteCSV(t *testing.T) {
+	var b strings.Builder
+	err := WriteCSV(&b, Result{
+		Utilisation: 0.5,
+		Classes: []ClassResult{
+			{Priority: priority.High, Requests: 4, Acquired: 3, TimedOut: 1, Wait50: time.Millisecond, WaitMax: 2500 * time.Microsecond},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "priority,requests,acquired,bypass_rate,timeout_rate,wait_p50,wait_p90,wait_p99,wait_max,utilisation\n"+
+		"4,4,3,0.0000,0.2500,1.0000,0.0000,0.0000,2.5000,0.5000\n", b.String())
+}
+
+func TestWriteTable(t *testing.T) {
+	var b strings.Builder
+	err := WriteTable(&b, Result{
+		Elapsed:     time.Second,
+		Utilisation: 0.5,
+		Classes:     []ClassResult{{Priority: priority.Low, Requests: 2, Acquired: 2}},
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, b.String(), "timeout_rate")
+	assert.Contains(t, b.String(), "utilisation 50.00% over 1s")
+}
@@ -0,0 +1,103 @@
+package limiter
+
+import (
+	"container/list"
+	"runtime/debug"
+	"time"
+)
+
+// Acquisition is capacity acquired from a limiter , recorded when tracking is enabled.
+type Acquisition struct {
+	// Time is when the capacity was acquired.
+	Time time.Time
+	// Stack is the stack of the acquirer.
+	Stack []byte
+	// Approximate is set for capacity acquired with Wait. Finish can't tell which caller releases
+	// the capacity and forgets the oldest Wait , so Stack is the likely acquirer of a leak.
+	Approximate bool
+}
+
+// NewAcquisition records an acquisition made by the calling goroutine at the current time of
+// the clock. It is meant for limiter implementations.
+func NewAcquisition(clock Clock) Acquisition {
+	return Acquisition{
+		Time:  clock.Now(),
+		Stack: debug.Stack(),
+	}
+}
+
+// WithTracking records the stack of every acquisition until it is released , see Outstanding.
+// Acquisitions made with Wait are attributed approximately , see Acquisition.Approximate.
+// It is meant for tests as capturing the stack is expensive.
+func WithTracking() func(*Limiter) {
+	return func(l *Limiter) {
+		l.tracking = true
+	}
+}
+
+// Outstanding returns the acquisitions which were not released yet , oldest first. It returns nil
+// unless WithTracking is enabled.
+func (l *Limiter) Outstanding() []Acquisition {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.tracking {
+		return nil
+	}
+	acquisitions := make([]Acquisition, 0, l.acquisitions.Len())
+	for e := l.acquisitions.Front(); e != nil; e = e.Next() {
+		acquisitions = append(acquisitions, e.Value.(Acquisition))
+	}
+	return acquisitions
+}
+
+// acquisition records the calling goroutine if tracking is enabled.
+func (l *Limiter) acquisition() Acquisition {
+	if !l.tracking {
+		return Acquisition{}
+	}
+	return NewAcquisition(l.clock)
+}
+
+// record stores an acquisition until it is forgotten. It returns nil unless tracking is enabled.
+func (l *Limiter) record(a Acquisition) *list.Element {
+	if !l.tracking {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.acquisitions.PushBack(a)
+}
+
+// recordWait records an acquisition made with Wait if tracking is enabled.
+func (l *Limiter) recordWait() {
+	if !l.tracking {
+		return
+	}
+	a := NewAcquisition(l.clock)
+	a.Approximate = true
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.waits.PushBack(l.acquisitions.PushBack(a))
+}
+
+// forgetWait forgets the oldest acquisition made with Wait , Finish can't tell which one it releases.
+func (l *Limiter) forgetWait() {
+	if !l.tracking {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e := l.waits.Front(); e != nil {
+		l.acquisitions.Remove(l.waits.Remove(e).(*list.Element))
+	}
+}
+
+// forget removes an acquisition stored by record , it is safe to call more than once.
+func (l *Limiter) forget(e *list.Element) {
+	if e == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.acquisitions.Remove(e)
+}